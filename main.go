@@ -5,29 +5,25 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"io"
 	"os"
 	"runtime"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/pflag"
 
+	"go.xrstf.de/stalk/pkg/command"
+	"go.xrstf.de/stalk/pkg/condition"
 	"go.xrstf.de/stalk/pkg/diff"
+	"go.xrstf.de/stalk/pkg/input"
 	kubeutil "go.xrstf.de/stalk/pkg/kubernetes"
-	"go.xrstf.de/stalk/pkg/watcher"
+	"go.xrstf.de/stalk/pkg/metrics"
 
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/labels"
-	"k8s.io/apimachinery/pkg/runtime/schema"
-	yamlutil "k8s.io/apimachinery/pkg/util/yaml"
-	"k8s.io/apimachinery/pkg/watch"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/oidc"
-	"k8s.io/client-go/tools/clientcmd"
 )
 
 // These variables get set by ldflags during compilation.
@@ -54,17 +50,58 @@ func printVersion() {
 }
 
 type options struct {
+	configFile        string
+	profile           string
 	kubeconfig        string
+	kubeContext       string
+	compareContext    string
 	namespaces        []string
 	labels            string
 	hideManagedFields bool
-	jsonPath          string
+	jsonPaths         []string
 	hidePaths         []string
 	showPaths         []string
 	selector          labels.Selector
 	showEmpty         bool
 	disableWordDiff   bool
 	contextLines      int
+	matchListItems    bool
+	ignoreOrder       bool
+	managers          []string
+	annotateManagers  bool
+	decodeSecrets     bool
+	redactSecrets     bool
+	redactPaths       []string
+	redactRegexes     []string
+	maxValueLength    int
+	expandPaths       []string
+	expandEmbedded    bool
+	kindContextLines  []string
+	until             string
+	timeout           time.Duration
+	execCommand       string
+	execInput         string
+	execConcurrency   int
+	execQueueSize     int
+	execTimeout       time.Duration
+	webhookURLs       []string
+	webhookTemplate   string
+	webhookType       string
+	webhookSecret     string
+	webhookQueueSize  int
+	webhookRetries    int
+	webhookBackoff    time.Duration
+	webhookTimeout    time.Duration
+	metricsAddr       string
+	files             []string
+	filesInterval     time.Duration
+	against           []string
+	auditLog          string
+	auditWebhookAddr  string
+	titleTemplate     string
+	colorMode         string
+	layout            string
+	colorTheme        string
 	verbose           bool
 	version           bool
 }
@@ -77,18 +114,71 @@ func main() {
 		showEmpty:         false,
 		disableWordDiff:   false,
 		contextLines:      3,
+		matchListItems:    false,
+		colorMode:         diff.ColorAuto,
+		layout:            diff.LayoutUnified,
+		execInput:         command.InputDiff,
+		execConcurrency:   4,
+		execQueueSize:     100,
+		execTimeout:       30 * time.Second,
+		webhookQueueSize:  100,
+		webhookRetries:    3,
+		webhookBackoff:    time.Second,
+		webhookTimeout:    10 * time.Second,
+		filesInterval:     time.Second,
 	}
 
+	pflag.StringVar(&opt.configFile, "config", opt.configFile, "Configuration file with default options and profiles (uses $XDG_CONFIG_HOME/stalk/config.yaml by default)")
+	pflag.StringVarP(&opt.profile, "profile", "p", opt.profile, "Name of the profile from the configuration file to use")
 	pflag.StringVar(&opt.kubeconfig, "kubeconfig", opt.kubeconfig, "Kubeconfig file to use (uses $KUBECONFIG by default)")
+	pflag.StringVar(&opt.kubeContext, "context", opt.kubeContext, "Kubeconfig context to use (uses the current context by default)")
+	pflag.StringVar(&opt.compareContext, "compare-context", opt.compareContext, "Watch the same resources in this kubeconfig context as well and show the differences between both clusters")
 	pflag.StringArrayVarP(&opt.namespaces, "namespace", "n", opt.namespaces, "Kubernetes namespace to watch resources in (supports glob expression) (can be given multiple times)")
 	pflag.StringVarP(&opt.labels, "labels", "l", opt.labels, "Label-selector as an alternative to specifying resource names")
 	pflag.BoolVar(&opt.hideManagedFields, "hide-managed", opt.hideManagedFields, "Do not show managed fields")
-	pflag.StringVarP(&opt.jsonPath, "jsonpath", "j", opt.jsonPath, "JSON path expression to transform the output (applied before the --show paths)")
-	pflag.StringArrayVarP(&opt.showPaths, "show", "s", opt.showPaths, "Path expression to include in output (can be given multiple times) (applied before the --hide paths)")
-	pflag.StringArrayVarP(&opt.hidePaths, "hide", "h", opt.hidePaths, "Path expression to hide in output (can be given multiple times)")
+	pflag.StringArrayVarP(&opt.jsonPaths, "jsonpath", "j", opt.jsonPaths, "JSON path expression to transform the output (applied before the --show paths) (can be scoped to a kind, e.g. \"pods:{.status}\")")
+	pflag.StringArrayVarP(&opt.showPaths, "show", "s", opt.showPaths, "Path expression to include in output (can be given multiple times) (applied before the --hide paths) (can be scoped to a kind, e.g. \"deploy:spec.replicas\")")
+	pflag.StringArrayVarP(&opt.hidePaths, "hide", "h", opt.hidePaths, "Path expression to hide in output (can be given multiple times) (can be scoped to a kind, e.g. \"pods:status.conditions\")")
 	pflag.BoolVarP(&opt.showEmpty, "show-empty", "e", opt.showEmpty, "Do not hide changes which would produce no diff because of --hide/--show/--jsonpath")
 	pflag.BoolVarP(&opt.disableWordDiff, "diff-by-line", "w", opt.disableWordDiff, "Compare entire lines and do not highlight changes within words")
 	pflag.IntVarP(&opt.contextLines, "context-lines", "c", opt.contextLines, "Number of context lines to show in diffs")
+	pflag.BoolVar(&opt.matchListItems, "match-list-items", opt.matchListItems, "Match list items like containers, env vars and conditions by their key instead of their position (keys are taken from the cluster's OpenAPI schema)")
+	pflag.BoolVar(&opt.ignoreOrder, "ignore-order", opt.ignoreOrder, "Ignore the order of items in all lists, not only in those whose items are matched by key")
+	pflag.StringArrayVar(&opt.managers, "manager", opt.managers, "Only show changes made by this field manager, as determined from the managedFields (supports glob expressions) (can be given multiple times)")
+	pflag.BoolVar(&opt.annotateManagers, "annotate-managers", opt.annotateManagers, "Show which field managers own each changed field")
+	pflag.BoolVar(&opt.decodeSecrets, "decode-secrets", opt.decodeSecrets, "Base64-decode the data of Secrets and the binaryData of ConfigMaps before diffing (only values that are text)")
+	pflag.BoolVar(&opt.redactSecrets, "redact-secrets", opt.redactSecrets, "Replace the values of Secrets with a short hash and a changed/unchanged marker")
+	pflag.StringArrayVar(&opt.redactPaths, "redact", opt.redactPaths, "Path expression whose values are replaced with a short hash (can be given multiple times) (applied after the --show/--hide paths) (can be scoped to a kind, e.g. \"deploy:spec.template.spec.containers.env.value\")")
+	pflag.StringArrayVar(&opt.redactRegexes, "redact-regex", opt.redactRegexes, "Regular expression whose matches in any value are replaced with a short hash (can be given multiple times)")
+	pflag.StringArrayVar(&opt.expandPaths, "expand", opt.expandPaths, "Path expression of strings containing JSON or YAML to parse into nested structures before diffing (can be given multiple times) (applied before the --show paths) (can be scoped to a kind, e.g. \"configmaps:data.*\")")
+	pflag.BoolVar(&opt.expandEmbedded, "expand-embedded", opt.expandEmbedded, "Automatically parse all strings that contain JSON objects or lists, or multi-line YAML documents, into nested structures before diffing")
+	pflag.IntVar(&opt.maxValueLength, "max-value-length", opt.maxValueLength, "Truncate strings longer than this many characters and show their length and hash instead; changed values are reduced to the changed region (0 disables truncation)")
+	pflag.StringArrayVar(&opt.kindContextLines, "kind-context-lines", opt.kindContextLines, "Number of context lines to show in diffs for a specific kind (e.g. \"configmaps:10\") (can be given multiple times)")
+	pflag.StringArrayVar(&opt.files, "files", opt.files, "Watch local manifest files or directories instead of a cluster (can be given multiple times)")
+	pflag.DurationVar(&opt.filesInterval, "files-interval", opt.filesInterval, "How often to check the --files for changes")
+	pflag.StringVar(&opt.auditLog, "audit-log", opt.auditLog, "Replay changes from a Kubernetes audit log file (\"-\" for stdin) instead of watching a cluster (requires the RequestResponse audit level)")
+	pflag.StringVar(&opt.auditWebhookAddr, "audit-webhook-addr", opt.auditWebhookAddr, "Address (e.g. \":8443\") to receive audit events from the apiserver's audit webhook backend on instead of watching a cluster")
+	pflag.StringArrayVar(&opt.against, "against", opt.against, "Compare live objects against the desired state from local manifest files or directories instead of their previous versions (can be given multiple times)")
+	pflag.StringVar(&opt.until, "until", opt.until, "Exit once all watched resources satisfy this condition (e.g. \"Ready=True\" or \"{.status.phase}=Running\")")
+	pflag.DurationVar(&opt.timeout, "timeout", opt.timeout, "Exit with an error if the --until condition is not met within this duration (0 means no timeout)")
+	pflag.StringVar(&opt.execCommand, "exec", opt.execCommand, "Shell command to run for every printed change (event metadata is available as $STALK_* environment variables)")
+	pflag.StringVar(&opt.execInput, "exec-input", opt.execInput, "What to send to the --exec command's stdin, one of diff, json or none")
+	pflag.IntVar(&opt.execConcurrency, "exec-concurrency", opt.execConcurrency, "Maximum number of --exec commands to run in parallel")
+	pflag.IntVar(&opt.execQueueSize, "exec-queue-size", opt.execQueueSize, "Maximum number of pending --exec commands before events are dropped")
+	pflag.DurationVar(&opt.execTimeout, "exec-timeout", opt.execTimeout, "Maximum runtime of each --exec command (0 means no timeout)")
+	pflag.StringArrayVar(&opt.webhookURLs, "webhook", opt.webhookURLs, "URL to POST every printed change to (can be given multiple times)")
+	pflag.StringVar(&opt.webhookTemplate, "webhook-template", opt.webhookTemplate, "File containing a Go template to render the webhook payload with (sends the event as JSON by default)")
+	pflag.StringVar(&opt.webhookType, "webhook-content-type", opt.webhookType, "Content-Type header of webhook requests (application/json by default)")
+	pflag.StringVar(&opt.webhookSecret, "webhook-secret", opt.webhookSecret, "Secret to sign webhook payloads with (HMAC-SHA256; uses $STALK_WEBHOOK_SECRET by default)")
+	pflag.IntVar(&opt.webhookQueueSize, "webhook-queue-size", opt.webhookQueueSize, "Maximum number of pending events per webhook before events are dropped")
+	pflag.IntVar(&opt.webhookRetries, "webhook-retries", opt.webhookRetries, "Number of times to retry failed webhook deliveries")
+	pflag.DurationVar(&opt.webhookBackoff, "webhook-backoff", opt.webhookBackoff, "Initial delay between webhook retries (doubled after every attempt)")
+	pflag.DurationVar(&opt.webhookTimeout, "webhook-timeout", opt.webhookTimeout, "Timeout for each webhook request")
+	pflag.StringVar(&opt.titleTemplate, "title-template", opt.titleTemplate, "Go template to render the diff headers with (e.g. \"{{ .Kind }} {{ .Key }} by {{ .FieldManager }} after {{ .SinceLastChange }}\")")
+	pflag.StringVar(&opt.colorMode, "color", opt.colorMode, "When to color the output, one of auto (if stdout is a terminal and $NO_COLOR is not set), always or never")
+	pflag.StringVar(&opt.layout, "layout", opt.layout, "How to print diffs, one of unified, side-by-side (uses the terminal width) or fields (one line per changed field)")
+	pflag.StringVar(&opt.colorTheme, "color-theme", opt.colorTheme, "YAML file with custom styles for the diff output")
+	pflag.StringVar(&opt.metricsAddr, "metrics-addr", opt.metricsAddr, "Address (e.g. \":9090\") to expose Prometheus metrics on (disabled by default)")
 	pflag.BoolVarP(&opt.verbose, "verbose", "v", opt.verbose, "Enable more verbose output")
 	pflag.BoolVarP(&opt.version, "version", "V", opt.version, "Show version info and exit immediately")
 	pflag.Parse()
@@ -105,160 +195,152 @@ func main() {
 		TimestampFormat: time.RFC1123,
 	})
 
-	if opt.verbose {
-		log.SetLevel(logrus.DebugLevel)
-	}
-
-	// validate CLI flags
-	differOpts := &diff.Options{
-		ContextLines:     opt.contextLines,
-		DisableWordDiff:  true,
-		ExcludePaths:     opt.hidePaths,
-		IncludePaths:     opt.showPaths,
-		HideEmptyDiffs:   !opt.showEmpty,
-		JSONPath:         opt.jsonPath,
-		CreateColorTheme: diff.CreateColorTheme,
-		UpdateColorTheme: diff.UpdateColorTheme,
-		DeleteColorTheme: diff.DeleteColorTheme,
-	}
-
-	if opt.hideManagedFields {
-		differOpts.ExcludePaths = append(differOpts.ExcludePaths, "metadata.managedFields")
-	}
-
-	if err := differOpts.Validate(); err != nil {
-		log.Fatalf("Invalid CLI options: %v", err)
+	// `stalk diff` exits with 1 if differences were found, so errors use 2
+	diffMode := pflag.NArg() > 0 && pflag.Arg(0) == "diff"
+	if diffMode {
+		log.ExitFunc = func(int) {
+			os.Exit(2)
+		}
 	}
 
-	differ, err := diff.NewDiffer(differOpts, log)
+	profile, err := loadConfig(&opt)
 	if err != nil {
-		log.Fatalf("Failed to create differ: %v", err)
+		log.Fatalf("Failed to load configuration: %v", err)
 	}
 
-	printer := diff.NewPrinter(differ, log)
+	if opt.verbose {
+		log.SetLevel(logrus.DebugLevel)
+	}
 
 	if opt.kubeconfig == "" {
 		opt.kubeconfig = os.Getenv("KUBECONFIG")
 	}
 
 	args := pflag.Args()
-	if len(args) == 0 {
-		log.Fatal("No resource kind and name given.")
+	if len(args) == 0 && profile != nil && len(profile.Kinds) > 0 {
+		args = append([]string{strings.Join(profile.Kinds, ",")}, profile.Names...)
 	}
 
-	if args[0] == "-" {
-		watchStdin(log, os.Stdin, printer)
-	} else {
-		watchKubernetes(rootCtx, log, args, &opt, printer)
+	if len(args) == 0 && !opt.readFiles() && !opt.readAudit() {
+		log.Fatal("No resource kind and name given.")
 	}
-}
-
-func watchStdin(log logrus.FieldLogger, input io.Reader, printer *diff.Printer) {
-	decoder := yamlutil.NewYAMLOrJSONDecoder(input, 1024)
 
-	for {
-		object := unstructured.Unstructured{}
-		err := decoder.Decode(&object)
-		if err != nil {
-			if err == io.EOF {
-				break
-			}
-
-			log.Errorf("Failed to decode YAML object: %v", err)
-			continue
-		}
+	if diffMode && len(args) != 3 {
+		log.Fatal("Usage: stalk diff <old file> <new file>")
+	}
 
-		printer.Print(&object, watch.Modified)
+	if err := opt.validate(args, diffMode); err != nil {
+		log.Fatalf("Invalid CLI options: %v", err)
 	}
-}
 
-func watchKubernetes(ctx context.Context, log logrus.FieldLogger, args []string, appOpts *options, printer *diff.Printer) {
-	resourceKinds := strings.Split(strings.ToLower(args[0]), ",")
-	resourceNames := args[1:]
+	readStdin, readFiles, readAudit := opt.readStdin(args), opt.readFiles(), opt.readAudit()
 
-	// is there a label selector?
-	if appOpts.labels != "" {
-		selector, err := labels.Parse(appOpts.labels)
+	// setup kubernetes client
+	var resolver, compareResolver *kubeutil.Resolver
+	if !readStdin && !readFiles && !readAudit && !diffMode {
+		resolver, err = kubeutil.NewResolverForContext(opt.kubeconfig, opt.kubeContext, log)
 		if err != nil {
-			log.Fatalf("Invalid label selector: %v", err)
+			log.Fatalf("Failed to create Kubernetes client: %v", err)
 		}
-
-		appOpts.selector = selector
 	}
 
-	hasNames := len(resourceNames) > 0
-	if hasNames && appOpts.selector != nil {
-		log.Fatal("Cannot specify both resource names and a label selector at the same time.")
+	if opt.compareMode() {
+		compareResolver, err = kubeutil.NewResolverForContext(opt.kubeconfig, opt.compareContext, log)
+		if err != nil {
+			log.Fatalf("Failed to create Kubernetes client: %v", err)
+		}
 	}
 
-	// setup kubernetes client
-	rules := clientcmd.NewDefaultClientConfigLoadingRules()
-	rules.ExplicitPath = appOpts.kubeconfig
-
-	deferred := clientcmd.NewInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{}, os.Stdin)
-	config, err := deferred.ClientConfig()
+	differOpts, err := opt.differOptions(resolver, log)
 	if err != nil {
-		log.Fatalf("Failed to create Kubernetes client: %v", err)
+		log.Fatalf("Invalid CLI options: %v", err)
 	}
 
-	resolver, err := kubeutil.NewResolver(config, log)
+	differ, err := diff.NewDiffer(differOpts, log)
 	if err != nil {
-		log.Fatalf("Failed to create Kubernetes REST mapper: %v", err)
+		log.Fatalf("Failed to create differ: %v", err)
 	}
 
-	// validate resource kinds
-	log.Debug("Resolving resource kinds...")
+	if diffMode {
+		os.Exit(diffFiles(log, differ, localFilter(log, nil, &opt), args[1], args[2]))
+	}
 
-	kinds := map[string]schema.GroupVersionKind{}
-	for _, resourceKind := range resourceKinds {
-		log.Debugf("Resolving %s...", resourceKind)
+	printer := diff.NewPrinter(differ, log)
 
-		parsed, err := resolver.Resolve(resourceKind)
+	if len(opt.against) > 0 {
+		desired, err := input.LoadDesiredState(opt.against, log)
 		if err != nil {
-			log.Fatalf("Unknown resource kind %q: %v", resourceKind, err)
+			log.Fatalf("Failed to load desired state: %v", err)
 		}
 
-		//nolint:staticcheck
-		if parsed == nil {
-			log.Fatalf("Unknown resource kind %q", resourceKind)
+		if desired.Len() == 0 {
+			log.Fatal("No objects found in the --against manifests.")
 		}
 
-		//nolint:staticcheck
-		gvk := parsed.GroupVersionKind
-		kinds[gvk.String()] = gvk
+		log.Debugf("Loaded %d desired objects.", desired.Len())
+		printer.SetDesiredState(desired)
+	}
+
+	if opt.metricsAddr != "" {
+		metrics.Serve(opt.metricsAddr, log)
+	}
 
-		log.WithFields(logrus.Fields{
-			"group":   gvk.Group,
-			"version": gvk.Version,
-			"kind":    gvk.Kind,
-		}).Debug("Resolved")
+	if err := opt.addSinks(printer, log); err != nil {
+		log.Fatalf("Invalid CLI options: %v", err)
 	}
 
-	// setup watches for each kind
-	log.Debug("Starting to watch resources...")
+	// the sources stop once the --until condition is met or the --timeout is reached
+	ctx, cancel := context.WithCancel(rootCtx)
+	defer cancel()
 
-	wg := sync.WaitGroup{}
-	w := watcher.NewWatcher(printer, appOpts.namespaces, resourceNames)
+	var (
+		tracker *condition.Tracker
+		cond    condition.Condition
+	)
 
-	for _, gvk := range kinds {
-		dynamicInterface, err := resolver.ResourceInterfaceFor(gvk)
+	if opt.until != "" {
+		cond, err = condition.Parse(opt.until)
 		if err != nil {
-			log.Fatalf("Failed to create dynamic interface for %q resources: %v", gvk.Kind, err)
+			log.Fatalf("Invalid --until condition: %v", err)
 		}
 
-		wi, err := dynamicInterface.Watch(ctx, metav1.ListOptions{
-			LabelSelector: appOpts.labels,
-		})
-		if err != nil {
-			log.Fatalf("Failed to create watch for %q resources: %v", gvk.Kind, err)
+		tracker = condition.NewTracker(cond, log)
+		printer.AddObserver(tracker)
+
+		if opt.timeout > 0 {
+			ctx, cancel = context.WithTimeout(ctx, opt.timeout)
+			defer cancel()
 		}
 
-		wg.Add(1)
-		go func() {
-			w.Watch(ctx, wi)
-			wg.Done()
-		}()
+		go waitForCondition(ctx, cancel, tracker)
+	}
+
+	switch {
+	case readStdin:
+		watchStdin(ctx, log, os.Stdin, localFilter(log, args[1:], &opt), printer)
+	case readFiles:
+		watchFiles(ctx, log, localFilter(log, args, &opt), &opt, printer)
+	case readAudit:
+		watchAudit(ctx, log, localFilter(log, args, &opt), &opt, printer)
+	case opt.compareMode():
+		watchClusters(ctx, log, args, [2]*kubeutil.Resolver{resolver, compareResolver}, &opt, printer)
+	default:
+		watchKubernetes(ctx, log, args, resolver, &opt, printer, tracker)
 	}
 
-	wg.Wait()
+	printer.Close()
+
+	if tracker != nil {
+		select {
+		case <-tracker.Done():
+			log.Infof("All resources satisfy %s.", cond)
+
+		default:
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				log.Fatalf("Timed out after %v waiting for %s.", opt.timeout, cond)
+			}
+
+			log.Fatalf("Input ended before all resources satisfied %s.", opt.until)
+		}
+	}
 }
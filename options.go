@@ -0,0 +1,359 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+
+	"go.xrstf.de/stalk/pkg/command"
+	"go.xrstf.de/stalk/pkg/config"
+	"go.xrstf.de/stalk/pkg/diff"
+	"go.xrstf.de/stalk/pkg/input"
+	kubeutil "go.xrstf.de/stalk/pkg/kubernetes"
+	"go.xrstf.de/stalk/pkg/webhook"
+
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// loadConfig applies the defaults and the selected profile from the
+// configuration file to all options that have not been given explicitly.
+func loadConfig(opt *options) (*config.Profile, error) {
+	filename := opt.configFile
+	if filename == "" {
+		filename = config.DefaultFilename()
+	}
+
+	cfg, err := config.Load(filename)
+	if err != nil {
+		// it's fine if the default config file does not exist
+		if errors.Is(err, fs.ErrNotExist) && opt.configFile == "" && opt.profile == "" {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return cfg.Apply(pflag.CommandLine, opt.profile)
+}
+
+func (o *options) readStdin(args []string) bool {
+	return len(args) > 0 && args[0] == "-"
+}
+
+func (o *options) readFiles() bool {
+	return len(o.files) > 0
+}
+
+func (o *options) readAudit() bool {
+	return o.auditLog != "" || o.auditWebhookAddr != ""
+}
+
+func (o *options) compareMode() bool {
+	return o.compareContext != ""
+}
+
+// validate checks which flags can be combined with each other.
+func (o *options) validate(args []string, diffMode bool) error {
+	readStdin, readFiles, readAudit := o.readStdin(args), o.readFiles(), o.readAudit()
+
+	if diffMode {
+		switch {
+		case len(o.against) > 0:
+			return errors.New("--against cannot be used together with stalk diff")
+		case o.execCommand != "":
+			return errors.New("--exec cannot be used together with stalk diff")
+		case len(o.webhookURLs) > 0:
+			return errors.New("--webhook cannot be used together with stalk diff")
+		case o.until != "":
+			return errors.New("--until cannot be used together with stalk diff")
+		case readFiles:
+			return errors.New("--files cannot be used together with stalk diff")
+		case readAudit:
+			return errors.New("--audit-log and --audit-webhook-addr cannot be used together with stalk diff")
+		}
+	}
+
+	if readStdin && readFiles {
+		return errors.New("cannot read from stdin and --files at the same time")
+	}
+
+	if readAudit && (readStdin || readFiles) {
+		return errors.New("audit events cannot be combined with other sources")
+	}
+
+	if o.compareMode() {
+		switch {
+		case readStdin || readFiles || readAudit || diffMode:
+			return errors.New("--compare-context can only be used when watching a cluster")
+		case len(o.against) > 0:
+			return errors.New("--compare-context cannot be used together with --against")
+		case o.until != "":
+			return errors.New("--compare-context cannot be used together with --until")
+		}
+	}
+
+	if o.timeout < 0 {
+		return errors.New("timeout cannot be negative")
+	}
+
+	if o.timeout > 0 && o.until == "" {
+		return errors.New("--timeout can only be used together with --until")
+	}
+
+	return nil
+}
+
+// differOptions creates the options for the differ; the resolver is nil if
+// no cluster is watched.
+func (o *options) differOptions(resolver *kubeutil.Resolver, log logrus.FieldLogger) (*diff.Options, error) {
+	if err := diff.SetColorMode(o.colorMode, os.Stdout); err != nil {
+		return nil, fmt.Errorf("invalid --color value: %w", err)
+	}
+
+	createTheme, updateTheme, deleteTheme := diff.CreateColorTheme, diff.UpdateColorTheme, diff.DeleteColorTheme
+	if o.colorTheme != "" {
+		theme, err := diff.LoadColorTheme(o.colorTheme)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load color theme: %w", err)
+		}
+
+		createTheme, updateTheme, deleteTheme = diff.NewColorThemes(theme)
+	}
+
+	differOpts := &diff.Options{
+		ContextLines:     o.contextLines,
+		DisableWordDiff:  true,
+		HideEmptyDiffs:   !o.showEmpty,
+		TitleTemplate:    o.titleTemplate,
+		Layout:           o.layout,
+		MatchListItems:   o.matchListItems,
+		IgnoreOrder:      o.ignoreOrder,
+		Managers:         o.managers,
+		AnnotateManagers: o.annotateManagers,
+		DecodeSecrets:    o.decodeSecrets,
+		RedactSecrets:    o.redactSecrets,
+		RedactRegexes:    o.redactRegexes,
+		MaxValueLength:   o.maxValueLength,
+		ExpandEmbedded:   o.expandEmbedded,
+		KindMatcher:      kubeutil.NewKindMatcher(resolver),
+		CreateColorTheme: createTheme,
+		UpdateColorTheme: updateTheme,
+		DeleteColorTheme: deleteTheme,
+	}
+
+	if err := applyKindRules(differOpts, o); err != nil {
+		return nil, err
+	}
+
+	if o.hideManagedFields {
+		differOpts.ExcludePaths = append(differOpts.ExcludePaths, "metadata.managedFields")
+	}
+
+	if resolver != nil {
+		differOpts.ListKeyResolver = kubeutil.NewListKeys(resolver, log)
+	}
+
+	if o.layout == diff.LayoutSideBySide {
+		differOpts.Width = diff.TerminalWidth(os.Stdout)
+	}
+
+	// only determine the cluster name if it's actually going to be used
+	if o.titleTemplate != "" && resolver != nil {
+		differOpts.Cluster = kubeutil.CurrentCluster(o.kubeconfig, o.kubeContext)
+	}
+
+	if err := differOpts.Validate(); err != nil {
+		return nil, err
+	}
+
+	return differOpts, nil
+}
+
+// applyKindRules sorts the path rules, JSONPaths and context lines into the
+// global options and the options for each kind (for rules like
+// "pods:status.conditions").
+func applyKindRules(differOpts *diff.Options, opt *options) error {
+	kinds := map[string]*diff.KindOptions{}
+	kindNames := []string{}
+
+	kindOptions := func(kind string) *diff.KindOptions {
+		if _, exists := kinds[kind]; !exists {
+			kinds[kind] = &diff.KindOptions{Kind: kind}
+			kindNames = append(kindNames, kind)
+		}
+
+		return kinds[kind]
+	}
+
+	for _, rule := range opt.showPaths {
+		if kind, path := diff.ParseKindRule(rule); kind == "" {
+			differOpts.IncludePaths = append(differOpts.IncludePaths, path)
+		} else {
+			kindOpts := kindOptions(kind)
+			kindOpts.IncludePaths = append(kindOpts.IncludePaths, path)
+		}
+	}
+
+	for _, rule := range opt.hidePaths {
+		if kind, path := diff.ParseKindRule(rule); kind == "" {
+			differOpts.ExcludePaths = append(differOpts.ExcludePaths, path)
+		} else {
+			kindOpts := kindOptions(kind)
+			kindOpts.ExcludePaths = append(kindOpts.ExcludePaths, path)
+		}
+	}
+
+	for _, rule := range opt.expandPaths {
+		if kind, path := diff.ParseKindRule(rule); kind == "" {
+			differOpts.ExpandPaths = append(differOpts.ExpandPaths, path)
+		} else {
+			kindOpts := kindOptions(kind)
+			kindOpts.ExpandPaths = append(kindOpts.ExpandPaths, path)
+		}
+	}
+
+	for _, rule := range opt.redactPaths {
+		if kind, path := diff.ParseKindRule(rule); kind == "" {
+			differOpts.RedactPaths = append(differOpts.RedactPaths, path)
+		} else {
+			kindOpts := kindOptions(kind)
+			kindOpts.RedactPaths = append(kindOpts.RedactPaths, path)
+		}
+	}
+
+	for _, rule := range opt.jsonPaths {
+		kind, path := diff.ParseKindRule(rule)
+		if kind == "" {
+			if differOpts.JSONPath != "" {
+				return errors.New("only a single JSON path can be given per kind")
+			}
+
+			differOpts.JSONPath = path
+		} else {
+			kindOpts := kindOptions(kind)
+			if kindOpts.JSONPath != "" {
+				return errors.New("only a single JSON path can be given per kind")
+			}
+
+			kindOpts.JSONPath = path
+		}
+	}
+
+	for _, rule := range opt.kindContextLines {
+		kind, value := diff.ParseKindRule(rule)
+		if kind == "" {
+			return fmt.Errorf("invalid kind context lines %q, must be \"kind:lines\"", rule)
+		}
+
+		lines, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid kind context lines %q: %w", rule, err)
+		}
+
+		kindOptions(kind).ContextLines = &lines
+	}
+
+	for _, kind := range kindNames {
+		differOpts.Kinds = append(differOpts.Kinds, *kinds[kind])
+	}
+
+	return nil
+}
+
+// addSinks adds the --exec runner and the --webhook sink to the printer.
+func (o *options) addSinks(printer *diff.Printer, log logrus.FieldLogger) error {
+	if o.execCommand != "" {
+		runner, err := command.NewRunner(&command.Options{
+			Command:     o.execCommand,
+			Input:       o.execInput,
+			Concurrency: o.execConcurrency,
+			QueueSize:   o.execQueueSize,
+			Timeout:     o.execTimeout,
+		}, log)
+		if err != nil {
+			return fmt.Errorf("invalid --exec options: %w", err)
+		}
+
+		printer.AddSink(runner)
+	}
+
+	if len(o.webhookURLs) > 0 {
+		if o.webhookSecret == "" {
+			o.webhookSecret = os.Getenv("STALK_WEBHOOK_SECRET")
+		}
+
+		webhookOpts := &webhook.Options{
+			URLs:        o.webhookURLs,
+			ContentType: o.webhookType,
+			Secret:      o.webhookSecret,
+			QueueSize:   o.webhookQueueSize,
+			Retries:     o.webhookRetries,
+			Backoff:     o.webhookBackoff,
+			Timeout:     o.webhookTimeout,
+		}
+
+		if o.webhookTemplate != "" {
+			content, err := os.ReadFile(o.webhookTemplate)
+			if err != nil {
+				return fmt.Errorf("failed to read webhook template: %w", err)
+			}
+
+			webhookOpts.Template = string(content)
+		}
+
+		sink, err := webhook.NewSink(webhookOpts, log)
+		if err != nil {
+			return fmt.Errorf("invalid --webhook options: %w", err)
+		}
+
+		printer.AddSink(sink)
+	}
+
+	return nil
+}
+
+// localFilter returns a filter for objects that do not come from a cluster,
+// based on the optional kinds and names, the namespaces and the label selector.
+func localFilter(log logrus.FieldLogger, args []string, appOpts *options) *input.Filter {
+	filter := &input.Filter{
+		KindMatcher: kubeutil.NewKindMatcher(nil),
+		Namespaces:  appOpts.namespaces,
+	}
+
+	if len(args) > 0 {
+		filter.Kinds = strings.Split(strings.ToLower(args[0]), ",")
+		filter.Names = args[1:]
+	}
+
+	parseSelector(log, appOpts, filter.Names)
+	filter.Selector = appOpts.selector
+
+	return filter
+}
+
+// parseSelector parses the --labels option, which cannot be combined with
+// resource names.
+func parseSelector(log logrus.FieldLogger, appOpts *options, resourceNames []string) {
+	if appOpts.labels != "" {
+		selector, err := labels.Parse(appOpts.labels)
+		if err != nil {
+			log.Fatalf("Invalid label selector: %v", err)
+		}
+
+		appOpts.selector = selector
+	}
+
+	hasNames := len(resourceNames) > 0
+	if hasNames && appOpts.selector != nil {
+		log.Fatal("Cannot specify both resource names and a label selector at the same time.")
+	}
+}
@@ -0,0 +1,106 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+
+	"github.com/sirupsen/logrus"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Event is the subset of an audit.k8s.io/v1 Event that is required to
+// replay changes.
+type Event struct {
+	AuditID          string           `json:"auditID"`
+	Level            string           `json:"level"`
+	Stage            string           `json:"stage"`
+	RequestURI       string           `json:"requestURI"`
+	Verb             string           `json:"verb"`
+	User             UserInfo         `json:"user"`
+	ImpersonatedUser *UserInfo        `json:"impersonatedUser,omitempty"`
+	SourceIPs        []string         `json:"sourceIPs,omitempty"`
+	UserAgent        string           `json:"userAgent,omitempty"`
+	ObjectRef        *ObjectReference `json:"objectRef,omitempty"`
+	ResponseStatus   *metav1.Status   `json:"responseStatus,omitempty"`
+	RequestObject    json.RawMessage  `json:"requestObject,omitempty"`
+	ResponseObject   json.RawMessage  `json:"responseObject,omitempty"`
+	StageTimestamp   metav1.MicroTime `json:"stageTimestamp"`
+}
+
+type UserInfo struct {
+	Username string `json:"username"`
+}
+
+type ObjectReference struct {
+	Resource    string `json:"resource,omitempty"`
+	Namespace   string `json:"namespace,omitempty"`
+	Name        string `json:"name,omitempty"`
+	APIGroup    string `json:"apiGroup,omitempty"`
+	APIVersion  string `json:"apiVersion,omitempty"`
+	Subresource string `json:"subresource,omitempty"`
+}
+
+// eventList is what the apiserver's audit webhook backend sends.
+type eventList struct {
+	Kind  string   `json:"kind"`
+	Items []*Event `json:"items"`
+}
+
+// ReadEvents reads audit events from a log file, which contains one JSON
+// encoded event (or event list) per line. Invalid lines (e.g. lines that
+// were cut off during log rotation) are skipped.
+func ReadEvents(r io.Reader, log logrus.FieldLogger, handler func(*Event)) error {
+	reader := bufio.NewReader(r)
+
+	for lineNumber := 1; ; lineNumber++ {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			events, decodeErr := decodeEvents(line)
+			if decodeErr != nil {
+				log.Warnf("Skipping invalid audit event in line %d: %v", lineNumber, decodeErr)
+			}
+
+			for _, event := range events {
+				handler(event)
+			}
+		}
+
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+	}
+}
+
+// decodeEvents decodes a single event or an EventList.
+func decodeEvents(data []byte) ([]*Event, error) {
+	var list eventList
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, err
+	}
+
+	if list.Kind == "EventList" {
+		return list.Items, nil
+	}
+
+	event := &Event{}
+	if err := json.Unmarshal(data, event); err != nil {
+		return nil, err
+	}
+
+	if event.AuditID == "" {
+		return nil, errors.New("not an audit event")
+	}
+
+	return []*Event{event}, nil
+}
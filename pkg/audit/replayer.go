@@ -0,0 +1,249 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+
+	"go.xrstf.de/stalk/pkg/cache"
+	"go.xrstf.de/stalk/pkg/diff"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// Change is a change to a single object, reconstructed from an audit event.
+type Change struct {
+	Type   watch.EventType
+	Object *unstructured.Unstructured
+	Actor  *diff.Actor
+}
+
+// Replayer turns audit events into object changes. It remembers the last
+// known state of every object, as deletions usually only return a Status
+// instead of the deleted object.
+type Replayer struct {
+	log   logrus.FieldLogger
+	cache *cache.ResourceCache
+	// kinds maps resources to their kinds, as events only reference the
+	// resource (e.g. "deployments")
+	kinds map[schema.GroupVersionResource]string
+	lock  *sync.Mutex
+}
+
+func NewReplayer(log logrus.FieldLogger) *Replayer {
+	return &Replayer{
+		log:   log,
+		cache: cache.NewCache(),
+		kinds: map[schema.GroupVersionResource]string{},
+		lock:  &sync.Mutex{},
+	}
+}
+
+// Run replays the audit log file ("-" for stdin) first and then the events
+// received by the audit webhook on webhookAddr, until the context is
+// cancelled. Both sources are optional.
+func (r *Replayer) Run(ctx context.Context, logFile string, webhookAddr string, handler func(*Change)) error {
+	replay := func(event *Event) {
+		if ctx.Err() != nil {
+			return
+		}
+
+		if change := r.Replay(event); change != nil {
+			handler(change)
+		}
+	}
+
+	if logFile != "" {
+		var reader io.Reader = os.Stdin
+
+		if logFile != "-" {
+			f, err := os.Open(logFile)
+			if err != nil {
+				return fmt.Errorf("failed to open audit log: %w", err)
+			}
+			defer f.Close()
+
+			reader = f
+		}
+
+		// like stdin, the log cannot be interrupted while reading
+		result := make(chan error, 1)
+		go func() {
+			result <- ReadEvents(reader, r.log, replay)
+		}()
+
+		select {
+		case err := <-result:
+			if err != nil {
+				return fmt.Errorf("failed to read audit log: %w", err)
+			}
+
+		case <-ctx.Done():
+			return nil
+		}
+	}
+
+	if webhookAddr != "" {
+		if err := NewServer(webhookAddr, r.log).Run(ctx, replay); err != nil {
+			return fmt.Errorf("failed to receive audit events: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// Replay returns the change described by the audit event, or nil if the
+// event did not change an object (e.g. because it was a read request, failed
+// or does not contain the object because of its audit level).
+func (r *Replayer) Replay(event *Event) *Change {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if event.Stage != "ResponseComplete" || event.ObjectRef == nil {
+		return nil
+	}
+
+	if event.ResponseStatus != nil && event.ResponseStatus.Code >= 300 {
+		return nil
+	}
+
+	// dry runs do not change anything
+	if strings.Contains(event.RequestURI, "dryRun=") {
+		return nil
+	}
+
+	ref := event.ObjectRef
+	if ref.Subresource != "" && ref.Subresource != "status" {
+		return nil
+	}
+
+	var eventType watch.EventType
+	switch event.Verb {
+	case "create":
+		eventType = watch.Added
+	case "update", "patch":
+		eventType = watch.Modified
+	case "delete":
+		eventType = watch.Deleted
+	default:
+		return nil
+	}
+
+	gvr := schema.GroupVersionResource{Group: ref.APIGroup, Version: ref.APIVersion, Resource: ref.Resource}
+
+	obj := decodeObject(event.ResponseObject)
+	if obj == nil && eventType != watch.Modified {
+		// patches cannot be replayed without the response
+		obj = decodeObject(event.RequestObject)
+	}
+
+	if obj != nil {
+		r.kinds[gvr] = obj.GetKind()
+	}
+
+	if eventType == watch.Deleted {
+		obj, eventType = r.deleted(gvr, ref, obj)
+	}
+
+	if obj == nil {
+		r.log.Debugf("Audit event %s does not contain the %s object, skipping (use the RequestResponse level).", event.AuditID, ref.Resource)
+		return nil
+	}
+
+	if eventType == watch.Deleted {
+		r.cache.Delete(obj)
+	} else {
+		r.cache.Set(obj)
+	}
+
+	return &Change{
+		Type:   eventType,
+		Object: obj,
+		Actor:  newActor(event),
+	}
+}
+
+// deleted returns the deleted object; objects with finalizers or a grace
+// period are only marked for deletion, which is a modification.
+func (r *Replayer) deleted(gvr schema.GroupVersionResource, ref *ObjectReference, response *unstructured.Unstructured) (*unstructured.Unstructured, watch.EventType) {
+	if response != nil {
+		if response.GetDeletionTimestamp() != nil && (len(response.GetFinalizers()) > 0 || ptrValue(response.GetDeletionGracePeriodSeconds()) > 0) {
+			return response, watch.Modified
+		}
+
+		return response, watch.Deleted
+	}
+
+	kind, exists := r.kinds[gvr]
+	if !exists {
+		return nil, watch.Deleted
+	}
+
+	stub := &unstructured.Unstructured{}
+	stub.SetGroupVersionKind(gvr.GroupVersion().WithKind(kind))
+	stub.SetNamespace(ref.Namespace)
+	stub.SetName(ref.Name)
+
+	if cached, _ := r.cache.Get(stub); cached != nil {
+		return cached, watch.Deleted
+	}
+
+	return stub, watch.Deleted
+}
+
+// decodeObject returns the object, or nil if the data is empty or not an
+// object (like a Status).
+func decodeObject(data json.RawMessage) *unstructured.Unstructured {
+	if len(data) == 0 {
+		return nil
+	}
+
+	obj := &unstructured.Unstructured{}
+	if err := json.Unmarshal(data, &obj.Object); err != nil {
+		return nil
+	}
+
+	if obj.GetKind() == "" || obj.GetKind() == "Status" || obj.GetName() == "" {
+		return nil
+	}
+
+	return obj
+}
+
+func newActor(event *Event) *diff.Actor {
+	actor := &diff.Actor{
+		Username:  event.User.Username,
+		Verb:      event.Verb,
+		UserAgent: event.UserAgent,
+		Timestamp: event.StageTimestamp.Time,
+	}
+
+	if event.ImpersonatedUser != nil {
+		actor.Username = event.ImpersonatedUser.Username + " (impersonated by " + event.User.Username + ")"
+	}
+
+	if len(event.SourceIPs) > 0 {
+		actor.SourceIP = event.SourceIPs[0]
+	}
+
+	return actor
+}
+
+func ptrValue(value *int64) int64 {
+	if value == nil {
+		return 0
+	}
+
+	return *value
+}
@@ -0,0 +1,77 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package audit
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+const testAuditLog = `
+{"auditID":"1","stage":"ResponseComplete","verb":"create","user":{"username":"alice"},"sourceIPs":["10.0.0.1"],"userAgent":"kubectl","objectRef":{"resource":"configmaps","namespace":"default","name":"test","apiVersion":"v1"},"responseStatus":{"code":201},"responseObject":{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"test","namespace":"default"}}}
+{"auditID":"2","stage":"RequestReceived","verb":"update","user":{"username":"bob"},"objectRef":{"resource":"configmaps","namespace":"default","name":"test","apiVersion":"v1"}}
+{"auditID":"3","stage":"ResponseComplete","verb":"get","user":{"username":"bob"},"objectRef":{"resource":"configmaps","namespace":"default","name":"test","apiVersion":"v1"},"responseStatus":{"code":200}}
+{"auditID":"4","stage":"ResponseComplete","verb":"patch","user":{"username":"bob"},"objectRef":{"resource":"configmaps","namespace":"default","name":"test","apiVersion":"v1"},"responseStatus":{"code":422}}
+{"auditID":"5","stage":"ResponseComplete","requestURI":"/api/v1/namespaces/default/configmaps/test?dryRun=All","verb":"patch","user":{"username":"bob"},"objectRef":{"resource":"configmaps","namespace":"default","name":"test","apiVersion":"v1"},"responseStatus":{"code":200},"responseObject":{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"test","namespace":"default"},"data":{"dry":"run"}}}
+this line was cut off during log rotation
+{"kind":"EventList","items":[{"auditID":"6","stage":"ResponseComplete","verb":"patch","user":{"username":"system:admin"},"impersonatedUser":{"username":"bob"},"objectRef":{"resource":"configmaps","namespace":"default","name":"test","apiVersion":"v1"},"responseStatus":{"code":200},"requestObject":{"data":{"a":"b"}},"responseObject":{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"test","namespace":"default"},"data":{"a":"b"}}}]}
+{"auditID":"7","stage":"ResponseComplete","verb":"patch","user":{"username":"bob"},"objectRef":{"resource":"configmaps","namespace":"default","name":"test","apiVersion":"v1"},"responseStatus":{"code":200},"requestObject":{"data":{"c":"d"}}}
+{"auditID":"8","stage":"ResponseComplete","verb":"delete","user":{"username":"carol"},"objectRef":{"resource":"configmaps","namespace":"default","name":"test","apiVersion":"v1"},"responseStatus":{"code":200},"responseObject":{"apiVersion":"v1","kind":"Status","status":"Success"}}
+`
+
+func TestReplayer(t *testing.T) {
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+
+	replayer := NewReplayer(log)
+	changes := []*Change{}
+
+	err := ReadEvents(strings.NewReader(testAuditLog), log, func(event *Event) {
+		if change := replayer.Replay(event); change != nil {
+			changes = append(changes, change)
+		}
+	})
+	if err != nil {
+		t.Fatalf("Failed to read events: %v", err)
+	}
+
+	expected := []struct {
+		eventType watch.EventType
+		username  string
+		data      string
+	}{
+		{eventType: watch.Added, username: "alice"},
+		{eventType: watch.Modified, username: "bob (impersonated by system:admin)", data: "b"},
+		// the deleted object is taken from the previous event
+		{eventType: watch.Deleted, username: "carol", data: "b"},
+	}
+
+	if len(changes) != len(expected) {
+		t.Fatalf("Expected %d changes, but got %d.", len(expected), len(changes))
+	}
+
+	for i, change := range changes {
+		if change.Type != expected[i].eventType {
+			t.Errorf("Expected change %d to be %v, but got %v.", i, expected[i].eventType, change.Type)
+		}
+
+		if change.Actor.Username != expected[i].username {
+			t.Errorf("Expected change %d to be made by %q, but got %q.", i, expected[i].username, change.Actor.Username)
+		}
+
+		data := change.Object.Object["data"]
+		if expected[i].data == "" {
+			if data != nil {
+				t.Errorf("Expected change %d to have no data, but got %v.", i, data)
+			}
+		} else if value := data.(map[string]interface{})["a"]; value != expected[i].data {
+			t.Errorf("Expected change %d to have data %q, but got %v.", i, expected[i].data, value)
+		}
+	}
+}
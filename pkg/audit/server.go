@@ -0,0 +1,90 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package audit
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// maxRequestSize limits the size of a single batch of audit events.
+const maxRequestSize = 64 << 20
+
+// Server receives audit events from the apiserver's audit webhook backend.
+type Server struct {
+	addr string
+	log  logrus.FieldLogger
+}
+
+func NewServer(addr string, log logrus.FieldLogger) *Server {
+	return &Server{
+		addr: addr,
+		log:  log,
+	}
+}
+
+// Run serves the webhook endpoint until the context is cancelled. Events are
+// passed to the handler one at a time, in the order they were received.
+func (s *Server) Run(ctx context.Context, handler func(*Event)) error {
+	server := &http.Server{
+		Addr:              s.addr,
+		Handler:           s.handler(handler),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		_ = server.Shutdown(shutdownCtx)
+	}()
+
+	s.log.Infof("Receiving audit events on %s...", s.addr)
+
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
+
+func (s *Server) handler(handler func(*Event)) http.Handler {
+	lock := &sync.Mutex{}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "only POST requests are supported", http.StatusMethodNotAllowed)
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxRequestSize))
+		if err != nil {
+			http.Error(w, "failed to read request body", http.StatusBadRequest)
+			return
+		}
+
+		events, err := decodeEvents(body)
+		if err != nil {
+			s.log.Warnf("Received invalid audit events: %v", err)
+			http.Error(w, "invalid audit events", http.StatusBadRequest)
+			return
+		}
+
+		lock.Lock()
+		for _, event := range events {
+			handler(event)
+		}
+		lock.Unlock()
+
+		w.WriteHeader(http.StatusOK)
+	})
+}
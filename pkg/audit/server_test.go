@@ -0,0 +1,64 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package audit
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestServer(t *testing.T) {
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+
+	received := []string{}
+	handler := NewServer("", log).handler(func(event *Event) {
+		received = append(received, event.AuditID)
+	})
+
+	testcases := []struct {
+		name           string
+		method         string
+		body           string
+		expectedStatus int
+	}{
+		{
+			name:           "event list",
+			method:         http.MethodPost,
+			body:           `{"kind":"EventList","apiVersion":"audit.k8s.io/v1","items":[{"auditID":"a"},{"auditID":"b"}]}`,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "invalid body",
+			method:         http.MethodPost,
+			body:           `not JSON`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "wrong method",
+			method:         http.MethodGet,
+			expectedStatus: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, httptest.NewRequest(testcase.method, "/", strings.NewReader(testcase.body)))
+
+			if recorder.Code != testcase.expectedStatus {
+				t.Errorf("Expected status %d, but got %d.", testcase.expectedStatus, recorder.Code)
+			}
+		})
+	}
+
+	if strings.Join(received, ",") != "a,b" {
+		t.Errorf("Expected events a,b, but got %v.", received)
+	}
+}
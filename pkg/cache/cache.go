@@ -41,12 +41,18 @@ func (rc *ResourceCache) Get(obj *unstructured.Unstructured) (*unstructured.Unst
 }
 
 func (rc *ResourceCache) Set(obj *unstructured.Unstructured) {
+	rc.SetSeen(obj, time.Now())
+}
+
+// SetSeen is like Set, but for objects that were seen at a different time,
+// for example when replaying past events.
+func (rc *ResourceCache) SetSeen(obj *unstructured.Unstructured, seen time.Time) {
 	rc.lock.Lock()
 	defer rc.lock.Unlock()
 
 	rc.resources[rc.objectKey(obj)] = cacheItem{
 		resource: obj.DeepCopy(),
-		lastSeen: time.Now(),
+		lastSeen: seen,
 	}
 }
 
@@ -57,6 +63,13 @@ func (rc *ResourceCache) Delete(obj *unstructured.Unstructured) {
 	delete(rc.resources, rc.objectKey(obj))
 }
 
+func (rc *ResourceCache) Len() int {
+	rc.lock.RLock()
+	defer rc.lock.RUnlock()
+
+	return len(rc.resources)
+}
+
 func (rc *ResourceCache) objectKey(obj *unstructured.Unstructured) string {
 	return fmt.Sprintf("%s/%s/%s", obj.GroupVersionKind().String(), obj.GetNamespace(), obj.GetName())
 }
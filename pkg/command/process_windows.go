@@ -0,0 +1,14 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+//go:build windows
+
+package command
+
+import (
+	"os/exec"
+)
+
+// killProcessGroup is a no-op on Windows, where only the command itself is
+// killed on cancellation.
+func killProcessGroup(cmd *exec.Cmd) {}
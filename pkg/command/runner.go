@@ -0,0 +1,229 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package command
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"go.xrstf.de/stalk/pkg/diff"
+)
+
+const (
+	// InputDiff sends the plain unified diff to the command.
+	InputDiff = "diff"
+	// InputJSON sends the entire event, including the old and new filtered
+	// documents, as JSON to the command.
+	InputJSON = "json"
+	// InputNone does not send anything to the command.
+	InputNone = "none"
+)
+
+type Options struct {
+	Command     string
+	Input       string
+	Concurrency int
+	QueueSize   int
+	Timeout     time.Duration
+}
+
+func (o *Options) Validate() error {
+	if strings.TrimSpace(o.Command) == "" {
+		return errors.New("command cannot be empty")
+	}
+
+	switch o.Input {
+	case InputDiff, InputJSON, InputNone:
+	default:
+		return fmt.Errorf("invalid input %q, must be one of %s, %s or %s", o.Input, InputDiff, InputJSON, InputNone)
+	}
+
+	if o.Concurrency < 1 {
+		return errors.New("concurrency must be at least 1")
+	}
+
+	if o.QueueSize < 1 {
+		return errors.New("queue size must be at least 1")
+	}
+
+	if o.Timeout < 0 {
+		return errors.New("timeout cannot be negative")
+	}
+
+	return nil
+}
+
+// Runner is a diff.Sink that runs an external command for every event.
+// Events are queued and handled by a fixed number of workers, so a slow
+// command does not delay the watches. When the queue is full, new events
+// are dropped.
+type Runner struct {
+	opt    *Options
+	log    logrus.FieldLogger
+	queue  chan *diff.Event
+	lock   *sync.Mutex
+	closed bool
+	wg     sync.WaitGroup
+}
+
+var _ diff.Sink = &Runner{}
+
+func NewRunner(opt *Options, log logrus.FieldLogger) (*Runner, error) {
+	if err := opt.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid options: %w", err)
+	}
+
+	r := &Runner{
+		opt:   opt,
+		log:   log,
+		queue: make(chan *diff.Event, opt.QueueSize),
+		lock:  &sync.Mutex{},
+	}
+
+	for i := 0; i < opt.Concurrency; i++ {
+		r.wg.Add(1)
+
+		go func() {
+			defer r.wg.Done()
+
+			for event := range r.queue {
+				r.run(event)
+			}
+		}()
+	}
+
+	return r, nil
+}
+
+// Send queues the event without blocking. Events sent after Close or while
+// the queue is full are dropped.
+func (r *Runner) Send(event *diff.Event) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.closed {
+		return
+	}
+
+	select {
+	case r.queue <- event:
+	default:
+		r.log.Warn("Command queue is full, dropping event.")
+	}
+}
+
+// Close waits for all queued commands to finish.
+func (r *Runner) Close() {
+	r.lock.Lock()
+	if !r.closed {
+		r.closed = true
+		close(r.queue)
+	}
+	r.lock.Unlock()
+
+	r.wg.Wait()
+}
+
+func (r *Runner) run(event *diff.Event) {
+	log := r.log.WithFields(logrus.Fields{
+		"event": event.Type,
+		"kind":  event.Kind,
+		"name":  event.Name,
+	})
+
+	if event.Namespace != "" {
+		log = log.WithField("namespace", event.Namespace)
+	}
+
+	stdin, err := r.input(event)
+	if err != nil {
+		log.Errorf("Failed to prepare command input: %v", err)
+		return
+	}
+
+	ctx := context.Background()
+	if r.opt.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.opt.Timeout)
+		defer cancel()
+	}
+
+	var output bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", r.opt.Command)
+	cmd.Env = append(os.Environ(), environment(event)...)
+	cmd.Stdin = stdin
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
+	// do not wait forever for pipes kept open by leftover children
+	cmd.WaitDelay = time.Second
+	killProcessGroup(cmd)
+
+	if err := cmd.Run(); err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			err = fmt.Errorf("timed out after %v", r.opt.Timeout)
+		}
+
+		log.WithField("output", strings.TrimSpace(output.String())).Warnf("Command failed: %v", err)
+		return
+	}
+
+	log.WithField("output", strings.TrimSpace(output.String())).Debug("Command succeeded")
+}
+
+func (r *Runner) input(event *diff.Event) (io.Reader, error) {
+	switch r.opt.Input {
+	case InputDiff:
+		return strings.NewReader(event.Diff), nil
+
+	case InputJSON:
+		encoded, err := json.Marshal(event)
+		if err != nil {
+			return nil, err
+		}
+
+		return bytes.NewReader(encoded), nil
+
+	default:
+		return nil, nil
+	}
+}
+
+func environment(event *diff.Event) []string {
+	env := []string{
+		"STALK_EVENT=" + string(event.Type),
+		"STALK_TIMESTAMP=" + event.Timestamp.Format(time.RFC3339),
+		"STALK_API_VERSION=" + event.APIVersion,
+		"STALK_KIND=" + event.Kind,
+		"STALK_NAMESPACE=" + event.Namespace,
+		"STALK_NAME=" + event.Name,
+		"STALK_UID=" + event.UID,
+		"STALK_RESOURCE_VERSION=" + event.ResourceVersion,
+		"STALK_GENERATION=" + strconv.FormatInt(event.Generation, 10),
+	}
+
+	if event.Actor != nil {
+		env = append(env,
+			"STALK_USER="+event.Actor.Username,
+			"STALK_VERB="+event.Actor.Verb,
+			"STALK_USER_AGENT="+event.Actor.UserAgent,
+			"STALK_SOURCE_IP="+event.Actor.SourceIP,
+		)
+	}
+
+	return env
+}
@@ -0,0 +1,187 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package command
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"go.xrstf.de/stalk/pkg/diff"
+
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+func TestEnvironment(t *testing.T) {
+	timestamp := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	baseEnv := []string{
+		"STALK_EVENT=MODIFIED",
+		"STALK_TIMESTAMP=2023-01-02T03:04:05Z",
+		"STALK_API_VERSION=apps/v1",
+		"STALK_KIND=Deployment",
+		"STALK_NAMESPACE=default",
+		"STALK_NAME=web",
+		"STALK_UID=1234",
+		"STALK_RESOURCE_VERSION=42",
+		"STALK_GENERATION=3",
+	}
+
+	testcases := []struct {
+		name     string
+		actor    *diff.Actor
+		expected []string
+	}{
+		{
+			name:     "without actor",
+			expected: baseEnv,
+		},
+		{
+			name: "with actor",
+			actor: &diff.Actor{
+				Username:  "alice",
+				Verb:      "patch",
+				UserAgent: "kubectl",
+				SourceIP:  "10.0.0.1",
+			},
+			expected: append(append([]string{}, baseEnv...),
+				"STALK_USER=alice",
+				"STALK_VERB=patch",
+				"STALK_USER_AGENT=kubectl",
+				"STALK_SOURCE_IP=10.0.0.1",
+			),
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			event := &diff.Event{
+				Type:            watch.Modified,
+				Timestamp:       timestamp,
+				APIVersion:      "apps/v1",
+				Kind:            "Deployment",
+				Namespace:       "default",
+				Name:            "web",
+				UID:             "1234",
+				ResourceVersion: "42",
+				Generation:      3,
+				Actor:           testcase.actor,
+			}
+
+			env := environment(event)
+			if !reflect.DeepEqual(testcase.expected, env) {
+				t.Errorf("Expected %v, but got %v.", testcase.expected, env)
+			}
+		})
+	}
+}
+
+func TestRunner(t *testing.T) {
+	testcases := []struct {
+		name        string
+		concurrency int
+		queueSize   int
+		command     string
+		events      int
+		minRuns     int
+		maxRuns     int
+		// expectedOutput is the expected content of the first event's file
+		expectedOutput string
+	}{
+		{
+			name:        "all queued events are handled",
+			concurrency: 2,
+			queueSize:   10,
+			command:     `read -r line; echo "$line" > "$DIR/$STALK_NAME"`,
+			events:      5,
+			minRuns:     5,
+			maxRuns:     5,
+			// the diff is sent to stdin
+			expectedOutput: "the diff\n",
+		},
+		{
+			name:        "events are dropped when the queue is full",
+			concurrency: 1,
+			queueSize:   1,
+			command:     `touch "$DIR/$STALK_NAME"; sleep 0.2`,
+			events:      5,
+			minRuns:     1,
+			maxRuns:     2,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			dir := t.TempDir()
+			t.Setenv("DIR", dir)
+
+			runner, err := NewRunner(&Options{
+				Command:     testcase.command,
+				Input:       InputDiff,
+				Concurrency: testcase.concurrency,
+				QueueSize:   testcase.queueSize,
+			}, logrus.New())
+			if err != nil {
+				t.Fatalf("Failed to create runner: %v", err)
+			}
+
+			for i := 0; i < testcase.events; i++ {
+				runner.Send(&diff.Event{Name: fmt.Sprintf("event-%d", i), Diff: "the diff\n"})
+			}
+
+			runner.Close()
+
+			// events after closing the runner are ignored
+			runner.Send(&diff.Event{Name: "late"})
+
+			files, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatalf("Failed to list output: %v", err)
+			}
+
+			if len(files) < testcase.minRuns || len(files) > testcase.maxRuns {
+				t.Errorf("Expected between %d and %d runs, but got %d.", testcase.minRuns, testcase.maxRuns, len(files))
+			}
+
+			if testcase.expectedOutput != "" {
+				content, err := os.ReadFile(filepath.Join(dir, "event-0"))
+				if err != nil {
+					t.Fatalf("Failed to read output: %v", err)
+				}
+
+				if string(content) != testcase.expectedOutput {
+					t.Errorf("Expected %q, but got %q.", testcase.expectedOutput, string(content))
+				}
+			}
+		})
+	}
+}
+
+func TestRunnerTimeout(t *testing.T) {
+	runner, err := NewRunner(&Options{
+		// the child keeps the output pipe open after the shell was killed
+		Command:     `sleep 3; echo done`,
+		Input:       InputNone,
+		Concurrency: 1,
+		QueueSize:   1,
+		Timeout:     300 * time.Millisecond,
+	}, logrus.New())
+	if err != nil {
+		t.Fatalf("Failed to create runner: %v", err)
+	}
+
+	start := time.Now()
+
+	runner.Send(&diff.Event{Name: "slow"})
+	runner.Close()
+
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Expected the command to be killed after the timeout, but it took %v.", elapsed)
+	}
+}
@@ -0,0 +1,175 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package condition
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/util/jsonpath"
+)
+
+// Condition is a check that can be evaluated against Kubernetes objects.
+type Condition interface {
+	Matches(obj *unstructured.Unstructured) (bool, error)
+	String() string
+}
+
+// Parse turns an expression into a Condition. Supported are status conditions
+// like "Ready" or "Ready=False" and JSONPath expressions like
+// "{.status.phase}=Running". JSONPath expressions without a value match as
+// soon as they yield a non-empty result. Both forms can optionally be
+// prefixed with "condition=" or "jsonpath=", like for `kubectl wait --for`.
+func Parse(expr string) (Condition, error) {
+	expr = strings.TrimSpace(expr)
+	if expr == "" {
+		return nil, errors.New("expression cannot be empty")
+	}
+
+	if after, ok := strings.CutPrefix(expr, "jsonpath="); ok {
+		return parseJSONPath(after)
+	}
+
+	if after, ok := strings.CutPrefix(expr, "condition="); ok {
+		return parseStatusCondition(after)
+	}
+
+	if strings.HasPrefix(expr, "{") {
+		return parseJSONPath(expr)
+	}
+
+	return parseStatusCondition(expr)
+}
+
+type statusCondition struct {
+	conditionType string
+	status        string
+}
+
+func parseStatusCondition(expr string) (Condition, error) {
+	conditionType, status, hasStatus := strings.Cut(expr, "=")
+	if !hasStatus {
+		status = "True"
+	}
+
+	conditionType = strings.TrimSpace(conditionType)
+	status = strings.TrimSpace(status)
+
+	if conditionType == "" {
+		return nil, errors.New("condition type cannot be empty")
+	}
+
+	if status == "" {
+		return nil, errors.New("condition status cannot be empty")
+	}
+
+	return &statusCondition{
+		conditionType: conditionType,
+		status:        status,
+	}, nil
+}
+
+func (c *statusCondition) Matches(obj *unstructured.Unstructured) (bool, error) {
+	conditions, found, err := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	if err != nil {
+		return false, fmt.Errorf("invalid status conditions: %w", err)
+	}
+
+	if !found {
+		return false, nil
+	}
+
+	for _, item := range conditions {
+		cond, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		if !strings.EqualFold(fmt.Sprint(cond["type"]), c.conditionType) {
+			continue
+		}
+
+		return strings.EqualFold(fmt.Sprint(cond["status"]), c.status), nil
+	}
+
+	return false, nil
+}
+
+func (c *statusCondition) String() string {
+	return fmt.Sprintf("condition %s=%s", c.conditionType, c.status)
+}
+
+type jsonPathCondition struct {
+	expr     string
+	path     *jsonpath.JSONPath
+	value    string
+	hasValue bool
+}
+
+func parseJSONPath(expr string) (Condition, error) {
+	// the JSONPath itself can contain "=", e.g. in filter expressions, so
+	// the value can only begin after the last closing brace
+	end := strings.LastIndex(expr, "}")
+	if !strings.HasPrefix(expr, "{") || end < 0 {
+		return nil, fmt.Errorf("JSONPath expression %q must be enclosed in {}", expr)
+	}
+
+	cond := &jsonPathCondition{
+		expr: expr[:end+1],
+	}
+
+	if rest := expr[end+1:]; rest != "" {
+		value, ok := strings.CutPrefix(rest, "=")
+		if !ok {
+			return nil, fmt.Errorf("unexpected %q after JSONPath expression, expected \"=<value>\"", rest)
+		}
+
+		cond.value = value
+		cond.hasValue = true
+	}
+
+	path := jsonpath.New("until")
+	if err := path.Parse(cond.expr); err != nil {
+		return nil, fmt.Errorf("invalid JSON path: %w", err)
+	}
+
+	path.AllowMissingKeys(true)
+	cond.path = path
+
+	return cond, nil
+}
+
+func (c *jsonPathCondition) Matches(obj *unstructured.Unstructured) (bool, error) {
+	results, err := c.path.FindResults(obj.Object)
+	if err != nil {
+		return false, fmt.Errorf("failed to apply JSON path: %w", err)
+	}
+
+	found := false
+	for _, result := range results {
+		for _, value := range result {
+			if !value.IsValid() || !value.CanInterface() {
+				continue
+			}
+
+			found = true
+
+			if c.hasValue && fmt.Sprint(value.Interface()) != c.value {
+				return false, nil
+			}
+		}
+	}
+
+	return found, nil
+}
+
+func (c *jsonPathCondition) String() string {
+	if c.hasValue {
+		return fmt.Sprintf("%s=%s", c.expr, c.value)
+	}
+
+	return c.expr
+}
@@ -0,0 +1,107 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package condition
+
+import (
+	"fmt"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/json"
+)
+
+func TestConditions(t *testing.T) {
+	testcases := []struct {
+		input    string
+		expr     string
+		expected bool
+	}{
+		{
+			input:    `{"status":{"conditions":[{"type":"Ready","status":"True"}]}}`,
+			expr:     `Ready`,
+			expected: true,
+		},
+		{
+			input:    `{"status":{"conditions":[{"type":"Ready","status":"True"}]}}`,
+			expr:     `condition=ready=true`,
+			expected: true,
+		},
+		{
+			input:    `{"status":{"conditions":[{"type":"Ready","status":"False"}]}}`,
+			expr:     `Ready=True`,
+			expected: false,
+		},
+		{
+			input:    `{"status":{"conditions":[{"type":"Ready","status":"False"}]}}`,
+			expr:     `Ready=False`,
+			expected: true,
+		},
+		{
+			input:    `{"status":{}}`,
+			expr:     `Ready`,
+			expected: false,
+		},
+		{
+			input:    `{"status":{"phase":"Running"}}`,
+			expr:     `{.status.phase}=Running`,
+			expected: true,
+		},
+		{
+			input:    `{"status":{"phase":"Pending"}}`,
+			expr:     `jsonpath={.status.phase}=Running`,
+			expected: false,
+		},
+		{
+			input:    `{"status":{"phase":"Pending"}}`,
+			expr:     `{.status.phase}`,
+			expected: true,
+		},
+		{
+			input:    `{"status":{}}`,
+			expr:     `{.status.phase}`,
+			expected: false,
+		},
+		{
+			input:    `{"status":{"readyReplicas":3}}`,
+			expr:     `{.status.readyReplicas}=3`,
+			expected: true,
+		},
+		{
+			input:    `{"status":{"conditions":[{"type":"Available","status":"True"},{"type":"Progressing","status":"False"}]}}`,
+			expr:     `{.status.conditions[?(@.type=="Available")].status}=True`,
+			expected: true,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(fmt.Sprintf("%s against %s", testcase.expr, testcase.input), func(t *testing.T) {
+			obj := unstructured.Unstructured{}
+			if err := json.Unmarshal([]byte(testcase.input), &obj.Object); err != nil {
+				t.Fatalf("invalid testcase: %v", err)
+			}
+
+			cond, err := Parse(testcase.expr)
+			if err != nil {
+				t.Fatalf("invalid expression: %v", err)
+			}
+
+			matches, err := cond.Matches(&obj)
+			if err != nil {
+				t.Fatalf("failed to evaluate condition: %v", err)
+			}
+
+			if matches != testcase.expected {
+				t.Errorf("Expected %v, but got %v.", testcase.expected, matches)
+			}
+		})
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, expr := range []string{``, `=True`, `Ready=`, `{.status`, `{.status.phase}Running`} {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("Expected %q to be rejected, but it was accepted.", expr)
+		}
+	}
+}
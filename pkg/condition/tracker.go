@@ -0,0 +1,98 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package condition
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// Tracker remembers for every observed object whether it satisfies a
+// condition and signals once all of them do.
+type Tracker struct {
+	condition Condition
+	log       logrus.FieldLogger
+	objects   map[string]bool
+	lock      *sync.Mutex
+	done      chan struct{}
+	finished  bool
+}
+
+func NewTracker(condition Condition, log logrus.FieldLogger) *Tracker {
+	return &Tracker{
+		condition: condition,
+		log:       log,
+		objects:   map[string]bool{},
+		lock:      &sync.Mutex{},
+		done:      make(chan struct{}),
+	}
+}
+
+// Expect registers an object that must be observed before the Tracker can
+// be done. This prevents finishing early when the first of many objects
+// happens to already satisfy the condition.
+func (t *Tracker) Expect(obj *unstructured.Unstructured) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	key := t.objectKey(obj)
+	if _, exists := t.objects[key]; !exists {
+		t.objects[key] = false
+	}
+}
+
+func (t *Tracker) Observe(obj *unstructured.Unstructured, event watch.EventType) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	key := t.objectKey(obj)
+
+	switch event {
+	case watch.Added, watch.Modified:
+		matches, err := t.condition.Matches(obj)
+		if err != nil {
+			t.log.Warnf("Failed to evaluate %s for %s: %v", t.condition, key, err)
+		}
+
+		t.objects[key] = matches
+
+	case watch.Deleted:
+		delete(t.objects, key)
+
+	default:
+		return
+	}
+
+	t.checkDone()
+}
+
+// Done returns a channel that is closed once all known objects satisfy the
+// condition. As long as no object is known, the Tracker is not done.
+func (t *Tracker) Done() <-chan struct{} {
+	return t.done
+}
+
+func (t *Tracker) checkDone() {
+	if t.finished || len(t.objects) == 0 {
+		return
+	}
+
+	for _, satisfied := range t.objects {
+		if !satisfied {
+			return
+		}
+	}
+
+	t.finished = true
+	close(t.done)
+}
+
+func (t *Tracker) objectKey(obj *unstructured.Unstructured) string {
+	return fmt.Sprintf("%s/%s/%s", obj.GroupVersionKind().String(), obj.GetNamespace(), obj.GetName())
+}
@@ -0,0 +1,153 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package condition
+
+import (
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+func trackedPod(name string, phase string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion("v1")
+	obj.SetKind("Pod")
+	obj.SetNamespace("default")
+	obj.SetName(name)
+	_ = unstructured.SetNestedField(obj.Object, phase, "status", "phase")
+
+	return obj
+}
+
+type trackerEvent struct {
+	event watch.EventType
+	obj   *unstructured.Unstructured
+}
+
+func TestTracker(t *testing.T) {
+	testcases := []struct {
+		name     string
+		expect   []*unstructured.Unstructured
+		events   []trackerEvent
+		expected bool
+	}{
+		{
+			name:     "nothing observed",
+			expected: false,
+		},
+		{
+			name: "single matching object",
+			events: []trackerEvent{
+				{event: watch.Added, obj: trackedPod("a", "Running")},
+			},
+			expected: true,
+		},
+		{
+			name: "single object that does not match yet",
+			events: []trackerEvent{
+				{event: watch.Added, obj: trackedPod("a", "Pending")},
+			},
+			expected: false,
+		},
+		{
+			name: "object starts matching",
+			events: []trackerEvent{
+				{event: watch.Added, obj: trackedPod("a", "Pending")},
+				{event: watch.Modified, obj: trackedPod("a", "Running")},
+			},
+			expected: true,
+		},
+		{
+			name:   "expected objects must be observed",
+			expect: []*unstructured.Unstructured{trackedPod("a", ""), trackedPod("b", "")},
+			events: []trackerEvent{
+				{event: watch.Added, obj: trackedPod("a", "Running")},
+			},
+			expected: false,
+		},
+		{
+			name:   "all expected objects match",
+			expect: []*unstructured.Unstructured{trackedPod("a", ""), trackedPod("b", "")},
+			events: []trackerEvent{
+				{event: watch.Added, obj: trackedPod("a", "Running")},
+				{event: watch.Added, obj: trackedPod("b", "Running")},
+			},
+			expected: true,
+		},
+		{
+			name: "deleted objects are no longer waited for",
+			events: []trackerEvent{
+				{event: watch.Added, obj: trackedPod("a", "Running")},
+				{event: watch.Added, obj: trackedPod("b", "Pending")},
+				{event: watch.Deleted, obj: trackedPod("b", "Pending")},
+			},
+			expected: true,
+		},
+		{
+			name:   "deleting an expected object that was never observed",
+			expect: []*unstructured.Unstructured{trackedPod("a", ""), trackedPod("b", "")},
+			events: []trackerEvent{
+				{event: watch.Added, obj: trackedPod("a", "Running")},
+				{event: watch.Deleted, obj: trackedPod("b", "")},
+			},
+			expected: true,
+		},
+		{
+			name: "deleting all objects does not satisfy the condition",
+			events: []trackerEvent{
+				{event: watch.Added, obj: trackedPod("a", "Pending")},
+				{event: watch.Deleted, obj: trackedPod("a", "Pending")},
+			},
+			expected: false,
+		},
+		{
+			name: "done is final",
+			events: []trackerEvent{
+				{event: watch.Added, obj: trackedPod("a", "Running")},
+				{event: watch.Modified, obj: trackedPod("a", "Pending")},
+			},
+			expected: true,
+		},
+		{
+			name: "bookmarks are ignored",
+			events: []trackerEvent{
+				{event: watch.Bookmark, obj: trackedPod("a", "Running")},
+			},
+			expected: false,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			cond, err := Parse("{.status.phase}=Running")
+			if err != nil {
+				t.Fatalf("Failed to parse condition: %v", err)
+			}
+
+			tracker := NewTracker(cond, logrus.New())
+
+			for _, obj := range testcase.expect {
+				tracker.Expect(obj)
+			}
+
+			for _, event := range testcase.events {
+				tracker.Observe(event.obj, event.event)
+			}
+
+			done := false
+			select {
+			case <-tracker.Done():
+				done = true
+			default:
+			}
+
+			if done != testcase.expected {
+				t.Errorf("Expected done to be %v, but got %v.", testcase.expected, done)
+			}
+		})
+	}
+}
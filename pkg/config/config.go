@@ -0,0 +1,236 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/pflag"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Config contains default values for CLI flags and named profiles. Flags are
+// configured using their long names as keys, e.g.
+//
+//	context-lines: 5
+//	hide: [metadata.managedFields, status]
+//	profiles:
+//	  rollout:
+//	    kinds: [deployments, replicasets]
+//	    namespace: [production]
+//	    show: [spec.replicas, status]
+type Config struct {
+	Flags    map[string]interface{}
+	Profiles map[string]*Profile
+}
+
+// Profile is a named set of flags, optionally with the resource kinds and
+// names to watch.
+type Profile struct {
+	Kinds []string
+	Names []string
+	Flags map[string]interface{}
+}
+
+// DefaultFilename returns the path to the default configuration file, e.g.
+// ~/.config/stalk/config.yaml on Linux.
+func DefaultFilename() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(dir, "stalk", "config.yaml")
+}
+
+func Load(filename string) (*Config, error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return Parse(content)
+}
+
+func Parse(content []byte) (*Config, error) {
+	var flags map[string]interface{}
+	if err := yaml.Unmarshal(content, &flags); err != nil {
+		return nil, fmt.Errorf("invalid YAML: %w", err)
+	}
+
+	if flags == nil {
+		flags = map[string]interface{}{}
+	}
+
+	cfg := &Config{
+		Flags:    flags,
+		Profiles: map[string]*Profile{},
+	}
+
+	rawProfiles, ok := flags["profiles"]
+	if !ok {
+		return cfg, nil
+	}
+
+	delete(flags, "profiles")
+
+	profiles, ok := rawProfiles.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("profiles must be a map")
+	}
+
+	for name, rawProfile := range profiles {
+		profileFlags, ok := rawProfile.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("profile %q must be a map", name)
+		}
+
+		profile := &Profile{
+			Flags: profileFlags,
+		}
+
+		var err error
+
+		if kinds, ok := profileFlags["kinds"]; ok {
+			if profile.Kinds, err = toStrings(kinds); err != nil {
+				return nil, fmt.Errorf("invalid kinds in profile %q: %w", name, err)
+			}
+
+			delete(profileFlags, "kinds")
+		}
+
+		if names, ok := profileFlags["names"]; ok {
+			if profile.Names, err = toStrings(names); err != nil {
+				return nil, fmt.Errorf("invalid names in profile %q: %w", name, err)
+			}
+
+			delete(profileFlags, "names")
+		}
+
+		cfg.Profiles[name] = profile
+	}
+
+	return cfg, nil
+}
+
+// Apply sets all flags that have not been given explicitly on the command
+// line, first from the given profile (if any), then from the global
+// defaults. It returns the selected profile.
+func (c *Config) Apply(fs *pflag.FlagSet, profileName string) (*Profile, error) {
+	explicit := map[string]bool{}
+	fs.Visit(func(f *pflag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	var profile *Profile
+
+	if profileName != "" {
+		var ok bool
+
+		profile, ok = c.Profiles[profileName]
+		if !ok {
+			return nil, fmt.Errorf("unknown profile %q (available: %s)", profileName, strings.Join(c.profileNames(), ", "))
+		}
+
+		if err := applyFlags(fs, profile.Flags, explicit); err != nil {
+			return nil, fmt.Errorf("profile %q: %w", profileName, err)
+		}
+	}
+
+	if err := applyFlags(fs, c.Flags, explicit); err != nil {
+		return nil, err
+	}
+
+	return profile, nil
+}
+
+func (c *Config) profileNames() []string {
+	names := []string{}
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// applyFlags sets all given values on their flags, unless the flag has
+// already been set before. All flags that are set are recorded in done.
+func applyFlags(fs *pflag.FlagSet, values map[string]interface{}, done map[string]bool) error {
+	for name, value := range values {
+		flag := fs.Lookup(name)
+		if flag == nil || name == "config" || name == "profile" {
+			return fmt.Errorf("unknown option %q", name)
+		}
+
+		if done[name] {
+			continue
+		}
+
+		if sliceValue, ok := flag.Value.(pflag.SliceValue); ok {
+			items, err := toStrings(value)
+			if err != nil {
+				return fmt.Errorf("invalid value for %q: %w", name, err)
+			}
+
+			if err := sliceValue.Replace(items); err != nil {
+				return fmt.Errorf("invalid value for %q: %w", name, err)
+			}
+		} else {
+			if _, isList := value.([]interface{}); isList {
+				return fmt.Errorf("invalid value for %q: must not be a list", name)
+			}
+
+			if err := flag.Value.Set(formatValue(value)); err != nil {
+				return fmt.Errorf("invalid value for %q: %w", name, err)
+			}
+		}
+
+		done[name] = true
+	}
+
+	return nil
+}
+
+func toStrings(value interface{}) ([]string, error) {
+	switch v := value.(type) {
+	case string:
+		return []string{v}, nil
+
+	case []interface{}:
+		result := []string{}
+		for _, item := range v {
+			switch item.(type) {
+			case map[string]interface{}, []interface{}:
+				return nil, errors.New("list items must be scalar values")
+			}
+
+			result = append(result, formatValue(item))
+		}
+
+		return result, nil
+
+	default:
+		return nil, errors.New("must be a string or a list of strings")
+	}
+}
+
+// formatValue formats a scalar value from the configuration file as it would
+// have been given on the command line. YAML numbers are decoded as floats,
+// which must not be formatted in exponent notation (like 1e+06).
+func formatValue(value interface{}) string {
+	if f, ok := value.(float64); ok {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+
+	return fmt.Sprint(value)
+}
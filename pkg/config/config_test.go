@@ -0,0 +1,194 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package config
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/spf13/pflag"
+)
+
+const testConfig = `
+context-lines: 5
+hide: [metadata.managedFields]
+labels: app=global
+profiles:
+  rollout:
+    kinds: [deployments, replicasets]
+    names: my-app
+    show: [spec.replicas, status]
+    labels: app=rollout
+`
+
+type testOptions struct {
+	contextLines int
+	labels       string
+	hide         []string
+	show         []string
+}
+
+func newFlagSet(opt *testOptions) *pflag.FlagSet {
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	fs.IntVarP(&opt.contextLines, "context-lines", "c", 3, "")
+	fs.StringVarP(&opt.labels, "labels", "l", "", "")
+	fs.StringArrayVar(&opt.hide, "hide", nil, "")
+	fs.StringArrayVar(&opt.show, "show", nil, "")
+
+	return fs
+}
+
+func TestApply(t *testing.T) {
+	testcases := []struct {
+		name     string
+		args     []string
+		profile  string
+		expected testOptions
+	}{
+		{
+			name: "defaults only",
+			expected: testOptions{
+				contextLines: 5,
+				labels:       "app=global",
+				hide:         []string{"metadata.managedFields"},
+			},
+		},
+		{
+			name:    "profile overrides defaults",
+			profile: "rollout",
+			expected: testOptions{
+				contextLines: 5,
+				labels:       "app=rollout",
+				hide:         []string{"metadata.managedFields"},
+				show:         []string{"spec.replicas", "status"},
+			},
+		},
+		{
+			name:    "flags override profile and defaults",
+			args:    []string{"-c", "1", "--show", "spec", "--hide", "status"},
+			profile: "rollout",
+			expected: testOptions{
+				contextLines: 1,
+				labels:       "app=rollout",
+				hide:         []string{"status"},
+				show:         []string{"spec"},
+			},
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			cfg, err := Parse([]byte(testConfig))
+			if err != nil {
+				t.Fatalf("Failed to parse config: %v", err)
+			}
+
+			opt := testOptions{}
+			fs := newFlagSet(&opt)
+			if err := fs.Parse(testcase.args); err != nil {
+				t.Fatalf("Failed to parse flags: %v", err)
+			}
+
+			profile, err := cfg.Apply(fs, testcase.profile)
+			if err != nil {
+				t.Fatalf("Failed to apply config: %v", err)
+			}
+
+			if !reflect.DeepEqual(opt, testcase.expected) {
+				t.Errorf("Expected %+v, but got %+v.", testcase.expected, opt)
+			}
+
+			if testcase.profile != "" {
+				if !reflect.DeepEqual(profile.Kinds, []string{"deployments", "replicasets"}) {
+					t.Errorf("Expected kinds to be set, but got %v.", profile.Kinds)
+				}
+
+				if !reflect.DeepEqual(profile.Names, []string{"my-app"}) {
+					t.Errorf("Expected names to be set, but got %v.", profile.Names)
+				}
+			}
+		})
+	}
+}
+
+func TestApplyNumbers(t *testing.T) {
+	testcases := []struct {
+		name     string
+		config   string
+		expected testOptions
+	}{
+		{
+			name:     "large integers",
+			config:   "context-lines: 1000000",
+			expected: testOptions{contextLines: 1000000},
+		},
+		{
+			name:     "numbers in lists",
+			config:   "show: [1000000, 0.5, 12345678901]",
+			expected: testOptions{contextLines: 3, show: []string{"1000000", "0.5", "12345678901"}},
+		},
+		{
+			name:     "numbers as strings",
+			config:   "labels: 2000000",
+			expected: testOptions{contextLines: 3, labels: "2000000"},
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			cfg, err := Parse([]byte(testcase.config))
+			if err != nil {
+				t.Fatalf("Failed to parse config: %v", err)
+			}
+
+			opt := testOptions{}
+			if _, err := cfg.Apply(newFlagSet(&opt), ""); err != nil {
+				t.Fatalf("Failed to apply config: %v", err)
+			}
+
+			if !reflect.DeepEqual(opt, testcase.expected) {
+				t.Errorf("Expected %+v, but got %+v.", testcase.expected, opt)
+			}
+		})
+	}
+}
+
+func TestApplyInvalid(t *testing.T) {
+	testcases := []struct {
+		name    string
+		config  string
+		profile string
+	}{
+		{
+			name:   "unknown option",
+			config: `nope: true`,
+		},
+		{
+			name:   "invalid value",
+			config: `context-lines: many`,
+		},
+		{
+			name:   "list for scalar option",
+			config: `labels: [a, b]`,
+		},
+		{
+			name:    "unknown profile",
+			config:  `profiles: {}`,
+			profile: "nope",
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			cfg, err := Parse([]byte(testcase.config))
+			if err != nil {
+				t.Fatalf("Failed to parse config: %v", err)
+			}
+
+			if _, err := cfg.Apply(newFlagSet(&testOptions{}), testcase.profile); err == nil {
+				t.Fatal("Expected an error, but got none.")
+			}
+		})
+	}
+}
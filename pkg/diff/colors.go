@@ -4,25 +4,183 @@
 package diff
 
 import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
 	"github.com/gookit/color"
 	"github.com/shibukawa/cdiff"
+	"golang.org/x/term"
+
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// ColorAuto enables colors only if the output is a terminal and
+	// $NO_COLOR is not set.
+	ColorAuto = "auto"
+	// ColorAlways enables colors unconditionally.
+	ColorAlways = "always"
+	// ColorNever disables all colors.
+	ColorNever = "never"
 )
 
+// plainTags are used to render diffs without any colors.
+var plainTags = map[cdiff.Tag]string{
+	cdiff.CloseDeletedLine:  "\n",
+	cdiff.CloseInsertedLine: "\n",
+	cdiff.CloseKeepLine:     "\n",
+	cdiff.CloseSection:      "\n",
+	cdiff.CloseHeader:       "\n",
+}
+
 var (
 	CreateColorTheme map[cdiff.Tag]color.Style
 	UpdateColorTheme map[cdiff.Tag]color.Style
 	DeleteColorTheme map[cdiff.Tag]color.Style
 )
 
+// themeTags maps the names used in theme files to the tags that are used when
+// rendering diffs.
+var themeTags = map[string]cdiff.Tag{
+	"header":           cdiff.OpenHeader,
+	"section":          cdiff.OpenSection,
+	"deleted":          cdiff.OpenDeletedNotModified,
+	"deletedModified":  cdiff.OpenDeletedModified,
+	"inserted":         cdiff.OpenInsertedNotModified,
+	"insertedModified": cdiff.OpenInsertedModified,
+}
+
 func init() {
-	UpdateColorTheme = cloneColorTheme(cdiff.GooKitColorTheme)
-	UpdateColorTheme[cdiff.OpenHeader] = color.New(color.Yellow)
+	CreateColorTheme, UpdateColorTheme, DeleteColorTheme = NewColorThemes(DefaultColorTheme())
+}
 
-	CreateColorTheme = cloneColorTheme(UpdateColorTheme)
-	CreateColorTheme[cdiff.OpenInsertedModified] = nil
+// DefaultColorTheme returns the theme that is used for updated objects
+// unless the user provided their own theme.
+func DefaultColorTheme() map[cdiff.Tag]color.Style {
+	theme := cloneColorTheme(cdiff.GooKitColorTheme)
+	theme[cdiff.OpenHeader] = color.New(color.Yellow)
+
+	return theme
+}
+
+// NewColorThemes derives the themes for created, updated and deleted objects
+// from a single base theme.
+func NewColorThemes(base map[cdiff.Tag]color.Style) (created, updated, deleted map[cdiff.Tag]color.Style) {
+	updated = cloneColorTheme(base)
+
+	created = cloneColorTheme(updated)
+	created[cdiff.OpenInsertedModified] = nil
+
+	deleted = cloneColorTheme(updated)
+	deleted[cdiff.OpenDeletedModified] = nil
+
+	return created, updated, deleted
+}
+
+// LoadColorTheme reads a YAML file that maps theme tags (header, section,
+// deleted, deletedModified, inserted, insertedModified) to styles and
+// applies them on top of the default theme. Styles use the same syntax as
+// gookit/color tag attributes, e.g. "fg=black;bg=lightRed;op=bold". An empty
+// style disables the formatting for a tag.
+func LoadColorTheme(filename string) (map[cdiff.Tag]color.Style, error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var styles map[string]string
+	if err := yaml.UnmarshalStrict(content, &styles); err != nil {
+		return nil, fmt.Errorf("invalid theme file: %w", err)
+	}
+
+	theme := DefaultColorTheme()
+
+	for name, value := range styles {
+		tag, ok := themeTags[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown theme tag %q", name)
+		}
+
+		style, err := parseStyle(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid style for %s: %w", name, err)
+		}
+
+		theme[tag] = style
+	}
+
+	return theme, nil
+}
+
+func parseStyle(value string) (color.Style, error) {
+	var style color.Style
+
+	for _, attr := range strings.Split(value, ";") {
+		attr = strings.TrimSpace(attr)
+		if attr == "" {
+			continue
+		}
+
+		key, names, ok := strings.Cut(attr, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid attribute %q, must be fg=..., bg=... or op=...", attr)
+		}
+
+		for _, name := range strings.Split(names, ",") {
+			name = strings.TrimSpace(name)
+
+			var (
+				c     color.Color
+				found bool
+			)
+
+			switch strings.TrimSpace(key) {
+			case "fg":
+				if c, found = color.FgColors[name]; !found {
+					c, found = color.ExFgColors[name]
+				}
+			case "bg":
+				if c, found = color.BgColors[name]; !found {
+					c, found = color.ExBgColors[name]
+				}
+			case "op":
+				c, found = color.AllOptions[name]
+			default:
+				return nil, fmt.Errorf("unknown attribute %q, must be fg, bg or op", key)
+			}
+
+			if !found {
+				return nil, fmt.Errorf("unknown %s value %q", key, name)
+			}
+
+			style = append(style, c)
+		}
+	}
+
+	return style, nil
+}
+
+// SetColorMode configures whether or not diffs are colored. In auto mode,
+// colors are only used if output is a terminal and the NO_COLOR environment
+// variable is not set.
+func SetColorMode(mode string, output *os.File) error {
+	switch mode {
+	case ColorAlways:
+		color.Enable = true
+		color.ForceColor()
+	case ColorNever:
+		color.Disable()
+	case ColorAuto:
+		if os.Getenv("NO_COLOR") != "" || !term.IsTerminal(int(output.Fd())) {
+			color.Disable()
+		}
+	default:
+		return errors.New("must be one of auto, always or never")
+	}
 
-	DeleteColorTheme = cloneColorTheme(UpdateColorTheme)
-	DeleteColorTheme[cdiff.OpenDeletedModified] = nil
+	return nil
 }
 
 func cloneColorTheme(theme map[cdiff.Tag]color.Style) map[cdiff.Tag]color.Style {
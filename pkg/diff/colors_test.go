@@ -0,0 +1,168 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package diff
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/gookit/color"
+	"github.com/shibukawa/cdiff"
+)
+
+func TestParseStyle(t *testing.T) {
+	testcases := []struct {
+		value    string
+		expected color.Style
+		invalid  bool
+	}{
+		{
+			value:    "",
+			expected: nil,
+		},
+		{
+			value:    "fg=red",
+			expected: color.Style{color.FgRed},
+		},
+		{
+			value:    " fg=black ; bg=lightRed ; op=bold ",
+			expected: color.Style{color.FgBlack, color.BgLightRed, color.OpBold},
+		},
+		{
+			value:    "op=bold,underscore",
+			expected: color.Style{color.OpBold, color.OpUnderscore},
+		},
+		{
+			value:    "fg=lightBlue;",
+			expected: color.Style{color.FgLightBlue},
+		},
+		{
+			value:   "red",
+			invalid: true,
+		},
+		{
+			value:   "fg=nope",
+			invalid: true,
+		},
+		{
+			value:   "bg=red,nope",
+			invalid: true,
+		},
+		{
+			value:   "color=red",
+			invalid: true,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.value, func(t *testing.T) {
+			style, err := parseStyle(testcase.value)
+			if testcase.invalid {
+				if err == nil {
+					t.Fatalf("Expected %q to be invalid, but got %v.", testcase.value, style)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Failed to parse style: %v", err)
+			}
+
+			if !reflect.DeepEqual(testcase.expected, style) {
+				t.Errorf("Expected %v, but got %v.", testcase.expected, style)
+			}
+		})
+	}
+}
+
+func TestLoadColorTheme(t *testing.T) {
+	defaults := DefaultColorTheme()
+
+	testcases := []struct {
+		name     string
+		content  string
+		expected map[cdiff.Tag]color.Style
+		invalid  bool
+	}{
+		{
+			name:     "missing tags keep their defaults",
+			content:  "header: fg=cyan",
+			expected: map[cdiff.Tag]color.Style{cdiff.OpenHeader: {color.FgCyan}, cdiff.OpenSection: defaults[cdiff.OpenSection]},
+		},
+		{
+			name:    "all tags",
+			content: "header: fg=cyan\nsection: fg=blue\ndeleted: fg=red\ndeletedModified: bg=red\ninserted: fg=green\ninsertedModified: bg=green\n",
+			expected: map[cdiff.Tag]color.Style{
+				cdiff.OpenHeader:              {color.FgCyan},
+				cdiff.OpenSection:             {color.FgBlue},
+				cdiff.OpenDeletedNotModified:  {color.FgRed},
+				cdiff.OpenDeletedModified:     {color.BgRed},
+				cdiff.OpenInsertedNotModified: {color.FgGreen},
+				cdiff.OpenInsertedModified:    {color.BgGreen},
+			},
+		},
+		{
+			name:     "empty styles disable formatting",
+			content:  `section: ""`,
+			expected: map[cdiff.Tag]color.Style{cdiff.OpenSection: nil},
+		},
+		{
+			name:     "empty file",
+			content:  "",
+			expected: map[cdiff.Tag]color.Style{cdiff.OpenHeader: defaults[cdiff.OpenHeader]},
+		},
+		{
+			name:    "unknown tag",
+			content: "footer: fg=red",
+			invalid: true,
+		},
+		{
+			name:    "invalid style",
+			content: "header: fg=nope",
+			invalid: true,
+		},
+		{
+			name:    "styles must be strings",
+			content: "header: [fg=red]",
+			invalid: true,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "theme.yaml")
+			if err := os.WriteFile(filename, []byte(testcase.content), 0644); err != nil {
+				t.Fatalf("Failed to write theme: %v", err)
+			}
+
+			theme, err := LoadColorTheme(filename)
+			if testcase.invalid {
+				if err == nil {
+					t.Fatal("Expected theme to be invalid, but got no error.")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Failed to load theme: %v", err)
+			}
+
+			for tag, expected := range testcase.expected {
+				if !reflect.DeepEqual(expected, theme[tag]) {
+					t.Errorf("Expected %v for tag %v, but got %v.", expected, tag, theme[tag])
+				}
+			}
+		})
+	}
+}
+
+func TestLoadMissingColorTheme(t *testing.T) {
+	if _, err := LoadColorTheme(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("Expected missing theme file to return an error.")
+	}
+}
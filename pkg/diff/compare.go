@@ -0,0 +1,226 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package diff
+
+import (
+	"fmt"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// clusterFields are set by each cluster individually and would make every
+// object look different when comparing two clusters.
+var clusterFields = [][]string{
+	{"metadata", "uid"},
+	{"metadata", "resourceVersion"},
+	{"metadata", "generation"},
+	{"metadata", "creationTimestamp"},
+	{"metadata", "managedFields"},
+	{"metadata", "selfLink"},
+}
+
+// Comparison compares the objects of two clusters (or any other two sources
+// of objects). Objects are paired by their kind, namespace and name and
+// whenever either side changes, the diff between both versions is printed.
+type Comparison struct {
+	printer *Printer
+	names   [2]string
+	objects [2]map[string]*unstructured.Unstructured
+	// different contains the keys of all pairs whose last diff was not empty
+	different map[string]struct{}
+	started   bool
+	lock      *sync.Mutex
+}
+
+// NewComparison returns a new comparison between two sides with the given
+// names (e.g. the kubeconfig contexts). Diffs are printed using the Printer's
+// Differ and sent to its sinks.
+func NewComparison(printer *Printer, nameA, nameB string) *Comparison {
+	return &Comparison{
+		printer:   printer,
+		names:     [2]string{nameA, nameB},
+		objects:   [2]map[string]*unstructured.Unstructured{{}, {}},
+		different: map[string]struct{}{},
+		lock:      &sync.Mutex{},
+	}
+}
+
+// Side returns a handler for the events of one side (0 or 1).
+func (c *Comparison) Side(side int) *ComparisonSide {
+	return &ComparisonSide{
+		comparison: c,
+		side:       side,
+	}
+}
+
+// Load adds the objects that currently exist on one side, without printing
+// anything. This should be called for both sides before Start.
+func (c *Comparison) Load(side int, objects []*unstructured.Unstructured) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for _, obj := range objects {
+		c.objects[side][comparisonKey(obj)] = obj.DeepCopy()
+	}
+}
+
+// Start prints the diffs of all loaded pairs and lists all objects that
+// only exist on one side. Afterwards, every change is printed immediately.
+func (c *Comparison) Start() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	onlyIn := [2][]string{}
+
+	for _, key := range c.keys() {
+		objA, objB := c.objects[0][key], c.objects[1][key]
+
+		switch {
+		case objA == nil:
+			onlyIn[1] = append(onlyIn[1], key)
+		case objB == nil:
+			onlyIn[0] = append(onlyIn[0], key)
+		default:
+			c.compare(watch.Added, key)
+		}
+	}
+
+	for side, keys := range onlyIn {
+		for _, key := range keys {
+			c.printOnlyIn(side, c.objects[side][key])
+		}
+	}
+
+	if len(onlyIn[0]) > 0 || len(onlyIn[1]) > 0 {
+		fmt.Println()
+	}
+
+	c.started = true
+}
+
+// keys returns the sorted keys of all objects on both sides.
+func (c *Comparison) keys() []string {
+	keys := map[string]struct{}{}
+	for _, objects := range c.objects {
+		for key := range objects {
+			keys[key] = struct{}{}
+		}
+	}
+
+	return sortedKeys(keys)
+}
+
+func (c *Comparison) handle(side int, obj *unstructured.Unstructured, eventType watch.EventType) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	key := comparisonKey(obj)
+	existing := c.objects[side][key]
+
+	if eventType == watch.Deleted {
+		delete(c.objects[side], key)
+	} else {
+		// watches start with synthetic events for all objects that have
+		// already been loaded, which must not be shown again
+		if existing != nil && existing.GetResourceVersion() == obj.GetResourceVersion() {
+			return
+		}
+
+		c.objects[side][key] = obj.DeepCopy()
+	}
+
+	if !c.started {
+		return
+	}
+
+	other := c.objects[1-side][key]
+	switch {
+	case other != nil && eventType == watch.Deleted:
+		delete(c.different, key)
+		c.printOnlyIn(1-side, other)
+		fmt.Println()
+
+	case other == nil && eventType == watch.Deleted:
+		// gone on both sides now, nothing left to compare
+
+	case other == nil:
+		// only mention objects once, not on every change
+		if existing == nil {
+			c.printOnlyIn(side, obj)
+			fmt.Println()
+		}
+
+	default:
+		c.compare(eventType, key)
+	}
+}
+
+// compare prints the diff between both versions of the object. If both
+// versions became equal, this is mentioned once.
+func (c *Comparison) compare(eventType watch.EventType, key string) {
+	objA := withoutClusterFields(c.objects[0][key])
+	objB := withoutClusterFields(c.objects[1][key])
+
+	event, err := c.printer.differ.CompareObjects(objA, objB, c.names[0], c.names[1])
+	if err != nil {
+		c.printer.log.Errorf("Failed to compare %s: %v", key, err)
+		return
+	}
+
+	if event == nil || event.OldDocument == event.NewDocument {
+		if _, wasDifferent := c.different[key]; wasDifferent {
+			fmt.Printf("%s is now identical in %s and %s\n\n", c.printer.differ.DescribeObject(objA), c.names[0], c.names[1])
+			delete(c.different, key)
+		}
+
+		return
+	}
+
+	c.different[key] = struct{}{}
+	c.printer.send(eventType, event)
+}
+
+func (c *Comparison) printOnlyIn(side int, obj *unstructured.Unstructured) {
+	fmt.Printf("Only in %s: %s\n", c.names[side], c.printer.differ.DescribeObject(obj))
+}
+
+// ComparisonSide receives the events for one side of a Comparison.
+type ComparisonSide struct {
+	comparison *Comparison
+	side       int
+}
+
+func (s *ComparisonSide) Print(obj *unstructured.Unstructured, event watch.EventType) {
+	s.comparison.handle(s.side, obj, event)
+	s.comparison.printer.observe(obj, event)
+}
+
+// comparisonKey identifies objects regardless of their API version, as both
+// sides might prefer different versions.
+func comparisonKey(obj *unstructured.Unstructured) string {
+	return desiredKey(obj.GroupVersionKind().GroupKind(), obj.GetNamespace(), obj.GetName())
+}
+
+func withoutClusterFields(obj *unstructured.Unstructured) *unstructured.Unstructured {
+	obj = obj.DeepCopy()
+
+	for _, field := range clusterFields {
+		unstructured.RemoveNestedField(obj.Object, field...)
+	}
+
+	// owners have different UIDs in each cluster, too
+	if owners, found, _ := unstructured.NestedSlice(obj.Object, "metadata", "ownerReferences"); found {
+		for _, owner := range owners {
+			if owner, ok := owner.(map[string]interface{}); ok {
+				delete(owner, "uid")
+			}
+		}
+
+		_ = unstructured.SetNestedSlice(obj.Object, owners, "metadata", "ownerReferences")
+	}
+
+	return obj
+}
@@ -0,0 +1,121 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package diff
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+type recordingSink struct {
+	events []*Event
+}
+
+func (s *recordingSink) Send(event *Event) {
+	s.events = append(s.events, event)
+}
+
+func (s *recordingSink) Close() {}
+
+func comparisonObject(name string, resourceVersion string, replicas int64) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion("apps/v1")
+	obj.SetKind("Deployment")
+	obj.SetNamespace("default")
+	obj.SetName(name)
+	obj.SetUID(types.UID("uid-" + resourceVersion))
+	obj.SetResourceVersion(resourceVersion)
+	_ = unstructured.SetNestedField(obj.Object, replicas, "spec", "replicas")
+
+	return obj
+}
+
+func TestComparison(t *testing.T) {
+	differ, err := NewDiffer(&Options{HideEmptyDiffs: true}, logrus.New())
+	if err != nil {
+		t.Fatalf("Failed to create differ: %v", err)
+	}
+
+	sink := &recordingSink{}
+	printer := NewPrinter(differ, logrus.New())
+	printer.AddSink(sink)
+
+	comparison := NewComparison(printer, "staging", "production")
+	comparison.Load(0, []*unstructured.Unstructured{
+		comparisonObject("same", "1", 1),
+		comparisonObject("different", "2", 1),
+		comparisonObject("staging-only", "3", 1),
+	})
+	comparison.Load(1, []*unstructured.Unstructured{
+		comparisonObject("same", "10", 1),
+		comparisonObject("different", "11", 2),
+	})
+	comparison.Start()
+
+	if len(sink.events) != 1 || sink.events[0].Name != "different" {
+		t.Fatalf("Expected only the differing pair to be reported, but got %v.", sink.events)
+	}
+
+	// synthetic events from the initial watch must be ignored
+	comparison.Side(1).Print(comparisonObject("different", "11", 2), watch.Added)
+	if len(sink.events) != 1 {
+		t.Fatalf("Expected already known objects to be ignored, but got %d events.", len(sink.events))
+	}
+
+	comparison.Side(1).Print(comparisonObject("same", "12", 3), watch.Modified)
+	if len(sink.events) != 2 || sink.events[1].Name != "same" || sink.events[1].Type != watch.Modified {
+		t.Fatalf("Expected a change on either side to be reported, but got %v.", sink.events)
+	}
+
+	// becoming equal again does not produce a diff
+	comparison.Side(0).Print(comparisonObject("different", "4", 2), watch.Modified)
+	if len(sink.events) != 2 {
+		t.Fatalf("Expected identical objects to not be reported, but got %d events.", len(sink.events))
+	}
+
+	// objects that only exist on one side cannot be diffed
+	comparison.Side(1).Print(comparisonObject("production-only", "13", 1), watch.Added)
+	if len(sink.events) != 2 {
+		t.Fatalf("Expected objects on only one side to not be diffed, but got %d events.", len(sink.events))
+	}
+}
+
+func TestComparisonOwnerReferences(t *testing.T) {
+	differ, err := NewDiffer(&Options{HideEmptyDiffs: true, MatchListItems: true}, logrus.New())
+	if err != nil {
+		t.Fatalf("Failed to create differ: %v", err)
+	}
+
+	sink := &recordingSink{}
+	printer := NewPrinter(differ, logrus.New())
+	printer.AddSink(sink)
+
+	owned := func(resourceVersion string, ownerUID string) *unstructured.Unstructured {
+		obj := comparisonObject("owned", resourceVersion, 1)
+		obj.SetOwnerReferences([]metav1.OwnerReference{{APIVersion: "apps/v1", Kind: "ReplicaSet", Name: "owner", UID: types.UID(ownerUID)}})
+
+		return obj
+	}
+
+	comparison := NewComparison(printer, "staging", "production")
+	comparison.Load(0, []*unstructured.Unstructured{owned("1", "staging-uid")})
+	comparison.Load(1, []*unstructured.Unstructured{owned("2", "production-uid")})
+	comparison.Start()
+
+	if len(sink.events) != 0 {
+		t.Fatalf("Expected owner UIDs to be ignored, but got %v.", sink.events[0].Diff)
+	}
+
+	comparison.Side(1).Print(comparisonObject("owned", "3", 1), watch.Modified)
+	if len(sink.events) != 1 || !strings.Contains(sink.events[0].Diff, "ownerReferences") {
+		t.Fatalf("Expected a removed owner to be reported, but got %v.", sink.events)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gookit/color"
@@ -15,8 +16,10 @@ import (
 	"github.com/sirupsen/logrus"
 
 	"go.xrstf.de/stalk/pkg/maputil"
+	"go.xrstf.de/stalk/pkg/metrics"
 
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/util/json"
 	"sigs.k8s.io/yaml"
 )
@@ -24,6 +27,9 @@ import (
 type Differ struct {
 	opt *Options
 	log logrus.FieldLogger
+
+	kindOptions map[schema.GroupVersionKind]*Options
+	lock        *sync.Mutex
 }
 
 func NewDiffer(opt *Options, log logrus.FieldLogger) (*Differ, error) {
@@ -38,29 +44,192 @@ func NewDiffer(opt *Options, log logrus.FieldLogger) (*Differ, error) {
 	}
 
 	return &Differ{
-		opt: opt,
-		log: log,
+		opt:         opt,
+		log:         log,
+		kindOptions: map[schema.GroupVersionKind]*Options{},
+		lock:        &sync.Mutex{},
 	}, nil
 }
 
-func (d *Differ) PrintDiff(oldObj, newObj *unstructured.Unstructured, lastSeen time.Time) error {
-	oldString, err := d.preprocess(oldObj)
+// optionsFor returns the effective options for objects of the given kind.
+func (d *Differ) optionsFor(gvk schema.GroupVersionKind) *Options {
+	if len(d.opt.Kinds) == 0 {
+		return d.opt
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if opt, exists := d.kindOptions[gvk]; exists {
+		return opt
+	}
+
+	opt := d.opt
+	for _, kind := range d.opt.Kinds {
+		if d.opt.KindMatcher.MatchesKind(kind.Kind, gvk) {
+			opt = opt.ForKind(kind)
+		}
+	}
+
+	if opt != d.opt {
+		// all kind options have already been validated by NewDiffer
+		if err := opt.Validate(); err != nil {
+			d.log.Warnf("Invalid options for %s: %v", gvk.Kind, err)
+			opt = d.opt
+		}
+	}
+
+	d.kindOptions[gvk] = opt
+
+	return opt
+}
+
+// PrintDiff prints the diff between both objects and returns an Event
+// describing it. If no diff was printed, nil is returned.
+func (d *Differ) PrintDiff(oldObj, newObj *unstructured.Unstructured, lastSeen time.Time) (*Event, error) {
+	return d.PrintChange(oldObj, newObj, lastSeen, nil)
+}
+
+// PrintChange is like PrintDiff, but also shows who made the change. If the
+// actor has a timestamp, it is used instead of the current time.
+func (d *Differ) PrintChange(oldObj, newObj *unstructured.Unstructured, lastSeen time.Time, actor *Actor) (*Event, error) {
+	seen := time.Now()
+	if actor != nil && !actor.Timestamp.IsZero() {
+		seen = actor.Timestamp
+	}
+
+	managers := changedManagers(oldObj, newObj)
+	oldObj, newObj = d.prepareSecrets(oldObj, newObj)
+
+	obj := eventObject(oldObj, newObj)
+	if opt := d.optionsFor(obj.GroupVersionKind()); len(opt.Managers) > 0 && !matchesManagers(managers, opt.Managers) {
+		metrics.DiffsSuppressed.WithLabelValues(metrics.GVK(obj.GroupVersionKind())...).Inc()
+		return nil, nil
+	}
+
+	titleA := d.diffTitle(oldObj, lastSeen, time.Time{}, nil, nil, "")
+	titleB := d.diffTitle(newObj, seen, lastSeen, actor, managers, probableManager(managers, newObj))
+
+	event, err := d.printDiff(oldObj, newObj, titleA, titleB)
+	if event != nil {
+		event.Actor = actor
+		event.Managers = managers
+	}
+
+	return event, err
+}
+
+// CompareObjects is like PrintDiff, but for objects that have not been
+// observed over time, like objects from two different files. The sources
+// are shown in the diff headers instead of timestamps.
+func (d *Differ) CompareObjects(oldObj, newObj *unstructured.Unstructured, oldSource, newSource string) (*Event, error) {
+	oldObj, newObj = d.prepareSecrets(oldObj, newObj)
+
+	return d.printDiff(oldObj, newObj, sourceTitle(d.redactObject(oldObj), oldSource), sourceTitle(d.redactObject(newObj), newSource))
+}
+
+func sourceTitle(obj *unstructured.Unstructured, source string) string {
+	if obj == nil {
+		return "(none)"
+	}
+
+	return fmt.Sprintf("%s %s (%s)", obj.GetKind(), objectKey(obj), source)
+}
+
+// preparedDiff contains both objects after preprocessing them and aligning
+// their lists, i.e. everything needed to render a diff.
+type preparedDiff struct {
+	oldObj   *unstructured.Unstructured
+	newObj   *unstructured.Unstructured
+	oldData  interface{}
+	newData  interface{}
+	gvk      schema.GroupVersionKind
+	opt      *Options
+	listKeys listKeyFunc
+}
+
+// changes returns the changed fields between both objects.
+func (p *preparedDiff) changes() []fieldChange {
+	return compareFields(p.oldData, p.newData, p.listKeys)
+}
+
+func (d *Differ) prepareDiff(oldObj, newObj *unstructured.Unstructured) (*preparedDiff, error) {
+	gvk := eventObject(oldObj, newObj).GroupVersionKind()
+	opt := d.optionsFor(gvk)
+
+	oldData, err := d.timedPreprocess(oldObj, opt)
 	if err != nil {
-		return fmt.Errorf("failed to process previous object: %w", err)
+		return nil, fmt.Errorf("failed to process previous object: %w", err)
 	}
 
-	newString, err := d.preprocess(newObj)
+	newData, err := d.timedPreprocess(newObj, opt)
 	if err != nil {
-		return fmt.Errorf("failed to process current object: %w", err)
+		return nil, fmt.Errorf("failed to process current object: %w", err)
 	}
 
-	// this can happen if the spec changes, but `--show metadata` was given by the user
-	if oldString == newString && d.opt.HideEmptyDiffs {
-		return nil
+	listKeys := d.listKeys(gvk, opt)
+	if listKeys != nil || opt.IgnoreOrder {
+		oldData, newData = alignLists(oldData, newData, listKeys, opt.IgnoreOrder)
+	}
+
+	return &preparedDiff{
+		oldObj:   oldObj,
+		newObj:   newObj,
+		oldData:  oldData,
+		newData:  newData,
+		gvk:      gvk,
+		opt:      opt,
+		listKeys: listKeys,
+	}, nil
+}
+
+func (d *Differ) printDiff(oldObj, newObj *unstructured.Unstructured, titleA, titleB string) (*Event, error) {
+	prepared, err := d.prepareDiff(oldObj, newObj)
+	if err != nil {
+		return nil, err
+	}
+
+	return d.printPreparedDiff(prepared, titleA, titleB)
+}
+
+func (d *Differ) printPreparedDiff(prepared *preparedDiff, titleA, titleB string) (*Event, error) {
+	oldObj, newObj := prepared.oldObj, prepared.newObj
+	oldData, newData := prepared.oldData, prepared.newData
+	gvk, opt, listKeys := prepared.gvk, prepared.opt, prepared.listKeys
+
+	// titles contain names and labels, which could match a redact pattern
+	titleA = redactString(titleA, opt.compiledRedactRegexes)
+	titleB = redactString(titleB, opt.compiledRedactRegexes)
+
+	// lists need to be aligned first, so that the right items are compared
+	if opt.MaxValueLength > 0 {
+		oldData, newData = truncateValues(oldData, newData, opt.MaxValueLength)
+	}
+
+	// ownership cannot be determined if the JSONPath selected only a part of
+	// the object and is not interesting for created or deleted objects
+	var owners func(fieldChange) []string
+	if opt.AnnotateManagers && opt.compiledJSONPath == nil && oldObj != nil && newObj != nil {
+		owners = fieldOwners(oldObj, newObj, listKeys)
+	}
+
+	oldString, err := encodeYAML(oldData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode previous object: %w", err)
+	}
+
+	newString, err := encodeYAML(newData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode current object: %w", err)
 	}
 
-	titleA := diffTitle(oldObj, lastSeen)
-	titleB := diffTitle(newObj, time.Now())
+	gvkLabels := metrics.GVK(gvk)
+
+	// this can happen if the spec changes, but `--show metadata` was given by the user
+	if oldString == newString && opt.HideEmptyDiffs {
+		metrics.DiffsSuppressed.WithLabelValues(gvkLabels...).Inc()
+		return nil, nil
+	}
 
 	colorTheme := d.opt.UpdateColorTheme
 	if oldObj == nil {
@@ -70,39 +239,118 @@ func (d *Differ) PrintDiff(oldObj, newObj *unstructured.Unstructured, lastSeen t
 		colorTheme = d.opt.DeleteColorTheme
 	}
 
-	diff := cdiff.Diff(oldString, newString, cdiff.WordByWord)
+	unifiedDiff := func() *cdiff.Result {
+		diffStart := time.Now()
+		diff := cdiff.Diff(oldString, newString, cdiff.WordByWord)
+		metrics.DiffDuration.Observe(time.Since(diffStart).Seconds())
+
+		return &diff
+	}
+
+	// the fields layout does not need the word diff, so it is only computed
+	// once the event is sent to sinks
+	var diff *cdiff.Result
+
+	switch opt.Layout {
+	case LayoutSideBySide:
+		diff = unifiedDiff()
+		fmt.Print(renderSideBySide(*diff, titleA, titleB, opt.ContextLines, opt.Width, colorTheme))
+
+	case LayoutFields:
+		fmt.Print(renderFields(compareFields(oldData, newData, listKeys), titleA, titleB, opt.ContextLines, colorTheme, owners))
+
+	default:
+		diff = unifiedDiff()
+
+		var buf bytes.Buffer
+		color.Fprint(&buf, diff.UnifiedWithGooKitColor(titleA, titleB, opt.ContextLines, colorTheme))
+
+		fmt.Println(fixBadSection(buf.String(), colorTheme))
+	}
+
+	if owners != nil && opt.Layout != LayoutFields {
+		if annotations := renderOwners(compareFields(oldData, newData, listKeys), owners); annotations != "" {
+			fmt.Println(annotations)
+		}
+	}
 
-	var buf bytes.Buffer
-	color.Fprint(&buf, diff.UnifiedWithGooKitColor(titleA, titleB, d.opt.ContextLines, colorTheme))
+	metrics.DiffsPrinted.WithLabelValues(gvkLabels...).Inc()
 
-	fmt.Println(fixBadSection(buf.String(), colorTheme))
+	event := newEvent(d.redactObject(oldObj), d.redactObject(newObj))
+	event.Namespace = redactString(event.Namespace, opt.compiledRedactRegexes)
+	event.Name = redactString(event.Name, opt.compiledRedactRegexes)
+	event.OldDocument = oldString
+	event.NewDocument = newString
 
-	return nil
+	if diff != nil {
+		event.Diff = diff.UnifiedWithTag(titleA, titleB, opt.ContextLines, plainTags)
+	} else {
+		event.renderDiff = func() string {
+			return unifiedDiff().UnifiedWithTag(titleA, titleB, opt.ContextLines, plainTags)
+		}
+	}
+
+	return event, nil
 }
 
-func (d *Differ) preprocess(obj *unstructured.Unstructured) (string, error) {
+func (d *Differ) timedPreprocess(obj *unstructured.Unstructured, opt *Options) (interface{}, error) {
 	if obj == nil {
+		return nil, nil
+	}
+
+	start := time.Now()
+	defer func() {
+		metrics.PreprocessDuration.Observe(time.Since(start).Seconds())
+	}()
+
+	return d.preprocess(obj, opt)
+}
+
+// encodeYAML returns the YAML representation of the preprocessed object; a
+// nil value (i.e. no object) is encoded as an empty document. Multi-line
+// strings are always encoded as block scalars.
+func encodeYAML(data interface{}) (string, error) {
+	if data == nil {
 		return "", nil
 	}
 
-	generic, err := json.Marshal(obj)
+	blocks := map[string]string{}
+
+	encoded, err := json.Marshal(withBlockPlaceholders(data, blocks))
 	if err != nil {
 		return "", fmt.Errorf("failed to encode object as JSON: %w", err)
 	}
 
+	final, err := yaml.JSONToYAML(encoded)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode object as YAML: %w", err)
+	}
+
+	return renderBlockScalars(string(final), blocks), nil
+}
+
+// preprocess applies the JSONPath and path expressions to the object. The
+// result is usually a map, but a JSONPath can also result in a list or a
+// scalar value.
+func (d *Differ) preprocess(obj *unstructured.Unstructured, opt *Options) (interface{}, error) {
+	generic, err := json.Marshal(obj)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode object as JSON: %w", err)
+	}
+
 	var genericObj map[string]interface{}
 	if err := json.Unmarshal(generic, &genericObj); err != nil {
-		return "", fmt.Errorf("failed to re-decode object from JSON: %w", err)
+		return nil, fmt.Errorf("failed to re-decode object from JSON: %w", err)
 	}
 
-	if d.opt.compiledJSONPath != nil {
-		results, err := d.opt.compiledJSONPath.FindResults(genericObj)
+	if opt.compiledJSONPath != nil {
+		results, err := opt.compiledJSONPath.FindResults(genericObj)
 		if err != nil {
-			d.log.Warnf("Failed to apply JSON path: %w", err)
+			d.log.Warnf("Failed to apply JSON path: %v", err)
 		} else if len(results) > 0 && len(results[0]) > 0 {
 			generic, err = json.Marshal(results[0][0].Interface())
 			if err != nil {
-				return "", fmt.Errorf("failed to encode JSON path result as JSON: %w", err)
+				return nil, fmt.Errorf("failed to encode JSON path result as JSON: %w", err)
 			}
 
 			// reset the map
@@ -112,51 +360,63 @@ func (d *Differ) preprocess(obj *unstructured.Unstructured) (string, error) {
 				// the JSONPath might have resulted in a scalar value
 				var testValue interface{}
 				if innerErr := json.Unmarshal(generic, &testValue); innerErr != nil {
-					return "", fmt.Errorf("failed to re-decode JSON path result from JSON: %w", err)
+					return nil, fmt.Errorf("failed to re-decode JSON path result from JSON: %w", err)
+				}
+
+				for _, expandPath := range opt.parsedExpandPaths {
+					testValue = maputil.TransformPath(testValue, expandPath, expandValue)
 				}
 
-				final, err := yaml.JSONToYAML(generic)
-				if err != nil {
-					return "", fmt.Errorf("failed to encode object as YAML: %w", err)
+				if opt.ExpandEmbedded {
+					testValue = expandEmbedded(testValue)
 				}
 
-				return string(final), nil
+				// lists (e.g. of containers) can still contain values to redact
+				for _, redactPath := range opt.parsedRedactPaths {
+					testValue = maputil.TransformPath(testValue, redactPath, redactAll)
+				}
+
+				return redactMatches(testValue, opt.compiledRedactRegexes), nil
 			}
 		}
 	}
 
-	if len(d.opt.parsedIncludePaths) > 0 {
-		genericObj, err = maputil.PruneObject(genericObj, d.opt.parsedIncludePaths)
-		if err != nil {
-			return "", fmt.Errorf("failed to apply include inpressions: %w", err)
-		}
+	for _, expandPath := range opt.parsedExpandPaths {
+		genericObj = maputil.TransformPath(genericObj, expandPath, expandValue).(map[string]interface{})
+	}
 
-		generic, err = json.Marshal(genericObj)
-		if err != nil {
-			return "", fmt.Errorf("failed to encode include inpression result as JSON: %w", err)
-		}
+	if opt.ExpandEmbedded {
+		genericObj = expandEmbedded(genericObj).(map[string]interface{})
 	}
 
-	if len(d.opt.parsedExcludePaths) > 0 {
-		for _, excludePath := range d.opt.parsedExcludePaths {
-			genericObj, err = maputil.RemovePath(genericObj, excludePath)
-			if err != nil {
-				return "", fmt.Errorf("failed to apply exclude expression %v: %w", excludePath, err)
-			}
+	if len(opt.parsedIncludePaths) > 0 {
+		genericObj, err = maputil.PruneObject(genericObj, opt.parsedIncludePaths)
+		if err != nil {
+			return nil, fmt.Errorf("failed to apply include inpressions: %w", err)
 		}
+	}
 
-		generic, err = json.Marshal(genericObj)
+	for _, excludePath := range opt.parsedExcludePaths {
+		genericObj, err = maputil.RemovePath(genericObj, excludePath)
 		if err != nil {
-			return "", fmt.Errorf("failed to encode exclude expression result as JSON: %w", err)
+			return nil, fmt.Errorf("failed to apply exclude expression %v: %w", excludePath, err)
 		}
 	}
 
-	final, err := yaml.JSONToYAML(generic)
-	if err != nil {
-		return "", fmt.Errorf("failed to encode object as YAML: %w", err)
+	for _, redactPath := range opt.parsedRedactPaths {
+		genericObj = maputil.TransformPath(genericObj, redactPath, redactAll).(map[string]interface{})
 	}
 
-	return string(final), nil
+	return redactMatches(genericObj, opt.compiledRedactRegexes), nil
+}
+
+// DescribeObject returns the kind and name of the object for messages like
+// "Only in …", with all redactions applied.
+func (d *Differ) DescribeObject(obj *unstructured.Unstructured) string {
+	opt := d.optionsFor(obj.GroupVersionKind())
+	obj = d.redactObject(obj)
+
+	return redactString(fmt.Sprintf("%s %s", obj.GetKind(), objectKey(obj)), opt.compiledRedactRegexes)
 }
 
 func objectKey(obj *unstructured.Unstructured) string {
@@ -168,17 +428,6 @@ func objectKey(obj *unstructured.Unstructured) string {
 	return key
 }
 
-func diffTitle(obj *unstructured.Unstructured, lastSeen time.Time) string {
-	if obj == nil {
-		return "(none)"
-	}
-
-	timestamp := lastSeen.Format(time.RFC3339)
-	kind := obj.GroupVersionKind().Kind
-
-	return fmt.Sprintf("%s %s v%s (%s) (gen. %d)", kind, objectKey(obj), obj.GetResourceVersion(), timestamp, obj.GetGeneration())
-}
-
 // this ensures that the first line of a context/diff is not placed in the
 // same line as the @@...@@ marker
 func fixBadSection(output string, theme map[cdiff.Tag]color.Style) string {
@@ -0,0 +1,264 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package diff
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/shibukawa/cdiff"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// serverFields are populated by the apiserver or controllers and are never
+// part of a desired manifest.
+var serverFields = [][]string{
+	{"status"},
+	{"metadata", "uid"},
+	{"metadata", "resourceVersion"},
+	{"metadata", "generation"},
+	{"metadata", "creationTimestamp"},
+	{"metadata", "deletionTimestamp"},
+	{"metadata", "deletionGracePeriodSeconds"},
+	{"metadata", "managedFields"},
+	{"metadata", "selfLink"},
+	{"metadata", "annotations", "kubectl.kubernetes.io/last-applied-configuration"},
+	{"metadata", "annotations", "deployment.kubernetes.io/revision"},
+	{"metadata", "annotations", "deprecated.daemonset.template.generation"},
+}
+
+// DesiredState contains the desired objects (usually from local manifests)
+// that live objects are compared against. It also remembers how much each
+// object drifted the last time it was seen.
+type DesiredState struct {
+	objects map[string]desiredObject
+	drift   map[string]int
+	lock    *sync.Mutex
+}
+
+type desiredObject struct {
+	object *unstructured.Unstructured
+	source string
+}
+
+func NewDesiredState() *DesiredState {
+	return &DesiredState{
+		objects: map[string]desiredObject{},
+		drift:   map[string]int{},
+		lock:    &sync.Mutex{},
+	}
+}
+
+// Add adds a desired object, source is shown in the diff headers (e.g. the
+// filename).
+func (s *DesiredState) Add(obj *unstructured.Unstructured, source string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.objects[desiredKey(obj.GroupVersionKind().GroupKind(), obj.GetNamespace(), obj.GetName())] = desiredObject{
+		object: obj,
+		source: source,
+	}
+}
+
+func (s *DesiredState) Len() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return len(s.objects)
+}
+
+// get returns the desired state for the live object. Manifests often do not
+// specify a namespace, so those match objects in any namespace.
+func (s *DesiredState) get(live *unstructured.Unstructured) (desiredObject, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	gk := live.GroupVersionKind().GroupKind()
+
+	if desired, exists := s.objects[desiredKey(gk, live.GetNamespace(), live.GetName())]; exists {
+		return desired, true
+	}
+
+	desired, exists := s.objects[desiredKey(gk, "", live.GetName())]
+
+	return desired, exists
+}
+
+// updateDrift records the new amount of drift and returns the previous one
+// (or -1 if the object has not been seen before).
+func (s *DesiredState) updateDrift(live *unstructured.Unstructured, drift int) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	key := desiredKey(live.GroupVersionKind().GroupKind(), live.GetNamespace(), live.GetName())
+
+	previous, exists := s.drift[key]
+	if !exists {
+		previous = -1
+	}
+
+	s.drift[key] = drift
+
+	return previous
+}
+
+func desiredKey(gk schema.GroupKind, namespace, name string) string {
+	return fmt.Sprintf("%s/%s/%s", gk.String(), namespace, name)
+}
+
+// PrintDrift prints the difference between the desired and the live object
+// (nil if it has been deleted) and returns an Event describing it, plus the
+// number of drifted fields. Server-populated fields are ignored, as are all
+// fields of the live object that are not part of the desired object (like
+// defaulted fields), except for labels, annotations and list items.
+func (d *Differ) PrintDrift(desired, live *unstructured.Unstructured, source string) (*Event, int, error) {
+	gvk := desired.GroupVersionKind()
+	opt := d.optionsFor(gvk)
+	keys := d.listKeys(gvk, opt)
+
+	original := live
+
+	desired, live = d.prepareSecrets(desired, live)
+	desired = normalizeObject(desired)
+	if live != nil {
+		live = normalizeObject(live)
+		live.Object = pruneToDesired(nil, live.Object, desired.Object, keys).(map[string]interface{})
+	}
+
+	prepared, err := d.prepareDiff(desired, live)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	drift := len(prepared.changes())
+
+	titleB := "(deleted)"
+	if live != nil {
+		titleB = sourceTitle(d.redactObject(original), "live")
+	}
+
+	event, err := d.printPreparedDiff(prepared, sourceTitle(d.redactObject(desired), source), titleB)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// the normalized object lacks the metadata that sinks might rely on
+	if event != nil && original != nil {
+		event.UID = string(original.GetUID())
+		event.ResourceVersion = original.GetResourceVersion()
+		event.Generation = original.GetGeneration()
+	}
+
+	return event, drift, nil
+}
+
+// printDriftSummary prints how the drift of the object changed since it has
+// been seen before. As the summary is also printed when no diff was printed
+// (e.g. when the drift has been resolved), it names the object.
+func (d *Differ) printDriftSummary(obj *unstructured.Unstructured, drift, previous int) {
+	var summary string
+
+	switch {
+	case drift == 0 && previous <= 0:
+		return
+	case drift == 0:
+		summary = fmt.Sprintf("No drift anymore (was %s)", fieldCount(previous))
+	case previous < 0:
+		summary = fmt.Sprintf("Drift: %s", fieldCount(drift))
+	case drift > previous:
+		summary = fmt.Sprintf("Drift grew from %d to %s", previous, fieldCount(drift))
+	case drift < previous:
+		summary = fmt.Sprintf("Drift shrank from %d to %s", previous, fieldCount(drift))
+	default:
+		summary = fmt.Sprintf("Drift unchanged at %s", fieldCount(drift))
+	}
+
+	fmt.Println(d.opt.UpdateColorTheme[cdiff.OpenSection].Sprintf("%s: %s", d.DescribeObject(obj), summary))
+	fmt.Println()
+}
+
+func fieldCount(n int) string {
+	if n == 1 {
+		return "1 field"
+	}
+
+	return fmt.Sprintf("%d fields", n)
+}
+
+// normalizeObject returns a copy of the object without server-populated
+// fields.
+func normalizeObject(obj *unstructured.Unstructured) *unstructured.Unstructured {
+	obj = obj.DeepCopy()
+
+	for _, field := range serverFields {
+		unstructured.RemoveNestedField(obj.Object, field...)
+	}
+
+	if len(obj.GetAnnotations()) == 0 {
+		unstructured.RemoveNestedField(obj.Object, "metadata", "annotations")
+	}
+
+	return obj
+}
+
+// pruneToDesired removes all fields from the live value that do not exist
+// in the desired value. Labels, annotations and list items that only exist
+// in the live value are kept, as they are usually not added by defaulting.
+func pruneToDesired(path []string, live, desired interface{}, keys listKeyFunc) interface{} {
+	switch liveTyped := live.(type) {
+	case map[string]interface{}:
+		desiredTyped, ok := desired.(map[string]interface{})
+		if !ok {
+			return live
+		}
+
+		keepAll := len(path) == 2 && path[0] == "metadata" && (path[1] == "labels" || path[1] == "annotations")
+
+		for key, liveChild := range liveTyped {
+			desiredChild, exists := desiredTyped[key]
+			switch {
+			case exists:
+				liveTyped[key] = pruneToDesired(childPath(path, key), liveChild, desiredChild, keys)
+			case !keepAll:
+				delete(liveTyped, key)
+			}
+		}
+
+		return liveTyped
+
+	case []interface{}:
+		desiredTyped, ok := desired.([]interface{})
+		if !ok {
+			return live
+		}
+
+		var itemKeys []string
+		if keys != nil {
+			itemKeys = keys(path, liveTyped, desiredTyped)
+		}
+
+		if len(itemKeys) == 0 {
+			for i := 0; i < min(len(liveTyped), len(desiredTyped)); i++ {
+				liveTyped[i] = pruneToDesired(path, liveTyped[i], desiredTyped[i], keys)
+			}
+
+			return liveTyped
+		}
+
+		desiredIndex := indexItems(desiredTyped, itemKeys)
+		for i, liveItem := range liveTyped {
+			key, _ := itemKey(liveItem, itemKeys)
+			if j, exists := desiredIndex[key]; exists {
+				liveTyped[i] = pruneToDesired(path, liveItem, desiredTyped[j], keys)
+			}
+		}
+
+		return liveTyped
+	}
+
+	return live
+}
@@ -0,0 +1,66 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package diff
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestPruneToDesired(t *testing.T) {
+	testcases := []struct {
+		name     string
+		live     string
+		desired  string
+		expected string
+	}{
+		{
+			name:     "defaulted fields are removed",
+			live:     `{spec: {replicas: 1, revisionHistoryLimit: 10, strategy: {type: RollingUpdate}}}`,
+			desired:  `{spec: {replicas: 3}}`,
+			expected: `{spec: {replicas: 1}}`,
+		},
+		{
+			name:     "fields with different types are kept",
+			live:     `{spec: {value: {nested: true}}}`,
+			desired:  `{spec: {value: "string"}}`,
+			expected: `{spec: {value: {nested: true}}}`,
+		},
+		{
+			name:     "additional labels and annotations are kept",
+			live:     `{metadata: {name: a, uid: x, labels: {app: a, extra: b}}}`,
+			desired:  `{metadata: {name: a, labels: {app: a}}}`,
+			expected: `{metadata: {name: a, labels: {app: a, extra: b}}}`,
+		},
+		{
+			name:     "keyed list items are pruned by key",
+			live:     `{containers: [{name: sidecar, image: s, imagePullPolicy: Always}, {name: app, image: b, imagePullPolicy: Always}]}`,
+			desired:  `{containers: [{name: app, image: a}]}`,
+			expected: `{containers: [{name: sidecar, image: s, imagePullPolicy: Always}, {name: app, image: b}]}`,
+		},
+		{
+			name:     "unkeyed list items are pruned by position",
+			live:     `{args: [{a: 1, b: 2}, {a: 3, b: 4}]}`,
+			desired:  `{args: [{a: 1}]}`,
+			expected: `{args: [{a: 1}, {a: 3, b: 4}]}`,
+		},
+	}
+
+	keys := (&Differ{}).listKeys(schema.GroupVersionKind{Kind: "Pod"}, &Options{MatchListItems: true})
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			live := parseYAML(t, testcase.live)
+			desired := parseYAML(t, testcase.desired)
+			expected := parseYAML(t, testcase.expected)
+
+			result := pruneToDesired(nil, live, desired, keys)
+			if !reflect.DeepEqual(expected, result) {
+				t.Errorf("Expected %v, but got %v.", expected, result)
+			}
+		})
+	}
+}
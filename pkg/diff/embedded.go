@@ -0,0 +1,96 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package diff
+
+import (
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/json"
+	"sigs.k8s.io/yaml"
+)
+
+// expandValue replaces a string that contains a JSON or YAML object or list
+// with the parsed structure. All other values are returned as they are.
+func expandValue(value interface{}) interface{} {
+	s, ok := value.(string)
+	if !ok {
+		return value
+	}
+
+	if parsed, ok := parseEmbedded(s, true); ok {
+		return parsed
+	}
+
+	return value
+}
+
+// expandEmbedded walks the value and expands all strings that look like
+// JSON objects or lists, or multi-line YAML documents, including strings
+// embedded in expanded strings. Single-line strings are never parsed as
+// YAML, as almost every string is a valid YAML scalar.
+func expandEmbedded(value interface{}) interface{} {
+	switch asserted := value.(type) {
+	case map[string]interface{}:
+		for key, child := range asserted {
+			asserted[key] = expandEmbedded(child)
+		}
+
+		return asserted
+
+	case []interface{}:
+		for i, item := range asserted {
+			asserted[i] = expandEmbedded(item)
+		}
+
+		return asserted
+
+	case string:
+		if parsed, ok := parseEmbedded(asserted, isMultiline(asserted)); ok {
+			return expandEmbedded(parsed)
+		}
+	}
+
+	return value
+}
+
+// parseEmbedded parses the string as JSON or (if allowed) YAML. Only objects
+// and lists are accepted, so that plain strings are never turned into other
+// scalars.
+func parseEmbedded(s string, allowYAML bool) (interface{}, bool) {
+	trimmed := strings.TrimSpace(s)
+	if trimmed == "" {
+		return nil, false
+	}
+
+	var parsed interface{}
+
+	if strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[") {
+		if err := json.Unmarshal([]byte(trimmed), &parsed); err == nil {
+			return parsed, true
+		}
+	}
+
+	// only the first of multiple YAML documents would be parsed, so they
+	// are kept as they are instead of silently dropping the others
+	if !allowYAML || strings.Contains(s, "\n---") {
+		return nil, false
+	}
+
+	// decode via JSON to keep integers as int64 instead of float64
+	encoded, err := yaml.YAMLToJSON([]byte(s))
+	if err != nil {
+		return nil, false
+	}
+
+	if err := json.Unmarshal(encoded, &parsed); err != nil {
+		return nil, false
+	}
+
+	switch parsed.(type) {
+	case map[string]interface{}, []interface{}:
+		return parsed, true
+	}
+
+	return nil, false
+}
@@ -0,0 +1,103 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package diff
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestExpandEmbedded(t *testing.T) {
+	testcases := []struct {
+		name     string
+		opt      Options
+		obj      string
+		expected string
+	}{
+		{
+			name:     "JSON objects are expanded automatically",
+			opt:      Options{ExpandEmbedded: true},
+			obj:      `{"data":{"dashboard.json":"{\"title\":\"foo\",\"panels\":[1,2]}"}}`,
+			expected: `{"data":{"dashboard.json":{"panels":[1,2],"title":"foo"}}}`,
+		},
+		{
+			name:     "multi-line YAML is expanded automatically",
+			opt:      Options{ExpandEmbedded: true},
+			obj:      `{"data":{"values.yaml":"replicas: 3\nimage:\n  tag: v1\n"}}`,
+			expected: `{"data":{"values.yaml":{"image":{"tag":"v1"},"replicas":3}}}`,
+		},
+		{
+			name:     "embedded strings in expanded strings are expanded",
+			opt:      Options{ExpandEmbedded: true},
+			obj:      `{"a":"{\"b\":\"[1,2]\"}"}`,
+			expected: `{"a":{"b":[1,2]}}`,
+		},
+		{
+			name:     "single-line strings are not parsed as YAML automatically",
+			opt:      Options{ExpandEmbedded: true},
+			obj:      `{"a":"foo: bar","b":"[not json"}`,
+			expected: `{"a":"foo: bar","b":"[not json"}`,
+		},
+		{
+			name:     "plain text is kept",
+			opt:      Options{ExpandEmbedded: true},
+			obj:      `{"a":"first line\nsecond line\n","b":"server {\n  listen 80;\n}\n"}`,
+			expected: `{"a":"first line\nsecond line\n","b":"server {\n  listen 80;\n}\n"}`,
+		},
+		{
+			name:     "multiple YAML documents are kept",
+			opt:      Options{ExpandEmbedded: true},
+			obj:      `{"a":"foo: bar\n---\nfoo: baz\n"}`,
+			expected: `{"a":"foo: bar\n---\nfoo: baz\n"}`,
+		},
+		{
+			name:     "large numbers keep their precision",
+			opt:      Options{ExpandEmbedded: true},
+			obj:      `{"a":"{\"id\":1234567890123456789}","b":"id: 1234567890123456789\nratio: 0.5\n"}`,
+			expected: `{"a":{"id":1234567890123456789},"b":{"id":1234567890123456789,"ratio":0.5}}`,
+		},
+		{
+			name:     "configured paths are expanded",
+			opt:      Options{ExpandPaths: []string{"data.*"}},
+			obj:      `{"data":{"a":"foo: bar","b":"{\"c\":\"{}\"}"},"other":"{}"}`,
+			expected: `{"data":{"a":{"foo":"bar"},"b":{"c":"{}"}},"other":"{}"}`,
+		},
+		{
+			name:     "configured paths apply to list JSONPath results",
+			opt:      Options{JSONPath: "{.items}", ExpandPaths: []string{"spec"}},
+			obj:      `{"items":[{"spec":"{\"a\":1}"},{"spec":"b"}]}`,
+			expected: `[{"spec":{"a":1}},{"spec":"b"}]`,
+		},
+		{
+			name:     "expanded values can be hidden",
+			opt:      Options{ExpandPaths: []string{"data.values"}, ExcludePaths: []string{"data.values.version"}},
+			obj:      `{"data":{"values":"{\"version\":1,\"name\":\"foo\"}"}}`,
+			expected: `{"data":{"values":{"name":"foo"}}}`,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			differ, err := NewDiffer(&testcase.opt, logrus.New())
+			if err != nil {
+				t.Fatalf("Failed to create differ: %v", err)
+			}
+
+			obj := parseObject(t, testcase.obj)
+
+			result, err := differ.preprocess(obj, differ.optionsFor(obj.GroupVersionKind()))
+			if err != nil {
+				t.Fatalf("Failed to preprocess object: %v", err)
+			}
+
+			encoded, _ := json.Marshal(result)
+
+			if string(encoded) != testcase.expected {
+				t.Errorf("Expected %s, but got %s.", testcase.expected, encoded)
+			}
+		})
+	}
+}
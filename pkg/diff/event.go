@@ -0,0 +1,104 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package diff
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// Event describes a single change that the Printer has displayed. It only
+// contains the object's metadata and the filtered documents, never the
+// original, unfiltered objects.
+type Event struct {
+	Type            watch.EventType `json:"type"`
+	Timestamp       time.Time       `json:"timestamp"`
+	APIVersion      string          `json:"apiVersion"`
+	Kind            string          `json:"kind"`
+	Namespace       string          `json:"namespace,omitempty"`
+	Name            string          `json:"name"`
+	UID             string          `json:"uid,omitempty"`
+	ResourceVersion string          `json:"resourceVersion,omitempty"`
+	Generation      int64           `json:"generation,omitempty"`
+	OldDocument     string          `json:"oldDocument,omitempty"`
+	NewDocument     string          `json:"newDocument,omitempty"`
+	Diff            string          `json:"diff"`
+	// Actor is only known for some sources, like audit logs.
+	Actor *Actor `json:"actor,omitempty"`
+	// Managers are the field managers whose managedFields changed.
+	Managers []string `json:"managers,omitempty"`
+
+	// renderDiff computes Diff on demand, for layouts that do not need the
+	// unified diff themselves.
+	renderDiff func() string
+}
+
+// resolveDiff computes the unified diff if it was deferred.
+func (e *Event) resolveDiff() {
+	if e.renderDiff != nil {
+		e.Diff = e.renderDiff()
+		e.renderDiff = nil
+	}
+}
+
+// Actor describes who made a change and how.
+type Actor struct {
+	Username  string    `json:"username"`
+	Verb      string    `json:"verb"`
+	UserAgent string    `json:"userAgent,omitempty"`
+	SourceIP  string    `json:"sourceIP,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// String returns a short description like "alice (patch, kubectl/v1.32.2, 10.0.0.1)".
+func (a *Actor) String() string {
+	details := []string{a.Verb}
+	if a.UserAgent != "" {
+		details = append(details, a.UserAgent)
+	}
+	if a.SourceIP != "" {
+		details = append(details, a.SourceIP)
+	}
+
+	return fmt.Sprintf("%s (%s)", a.Username, strings.Join(details, ", "))
+}
+
+// Sink receives every event that the Printer displays.
+type Sink interface {
+	Send(event *Event)
+	// Close blocks until all previously sent events have been handled.
+	Close()
+}
+
+func newEvent(oldObj, newObj *unstructured.Unstructured) *Event {
+	event := &Event{
+		Timestamp: time.Now(),
+	}
+
+	if obj := eventObject(oldObj, newObj); obj != nil {
+		event.APIVersion = obj.GetAPIVersion()
+		event.Kind = obj.GetKind()
+		event.Namespace = obj.GetNamespace()
+		event.Name = obj.GetName()
+		event.UID = string(obj.GetUID())
+		event.ResourceVersion = obj.GetResourceVersion()
+		event.Generation = obj.GetGeneration()
+	}
+
+	return event
+}
+
+// eventObject returns the object that best describes a change, which is the
+// new object for additions and updates and the old one for deletions.
+func eventObject(oldObj, newObj *unstructured.Unstructured) *unstructured.Unstructured {
+	if newObj != nil {
+		return newObj
+	}
+
+	return oldObj
+}
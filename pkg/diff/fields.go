@@ -0,0 +1,309 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package diff
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/gookit/color"
+	"github.com/shibukawa/cdiff"
+)
+
+type fieldChangeType int
+
+const (
+	fieldChanged fieldChangeType = iota
+	fieldAdded
+	fieldRemoved
+)
+
+// fieldChange is a change to a single leaf value of an object.
+type fieldChange struct {
+	Type fieldChangeType
+	Path string
+	Old  interface{}
+	New  interface{}
+}
+
+// compareFields walks both values and returns one change per changed leaf.
+// Maps and lists are compared recursively; if a map or list is added or
+// removed, each of its leaves is reported individually. A nil value means
+// that the object did not exist (yet). If keys is given, list items are
+// matched by their keys instead of their position and added or removed
+// items are reported as a whole.
+func compareFields(oldValue, newValue interface{}, keys listKeyFunc) []fieldChange {
+	switch {
+	case oldValue == nil && newValue == nil:
+		return nil
+	case oldValue == nil:
+		return leafChanges(fieldAdded, "", newValue, nil)
+	case newValue == nil:
+		return leafChanges(fieldRemoved, "", oldValue, nil)
+	default:
+		return compareValues("", nil, oldValue, newValue, keys, nil)
+	}
+}
+
+// compareValues compares both values at the given path; fieldPath is the
+// path without list indices and is used to determine list keys.
+func compareValues(path string, fieldPath []string, oldValue, newValue interface{}, keys listKeyFunc, changes []fieldChange) []fieldChange {
+	switch oldTyped := oldValue.(type) {
+	case map[string]interface{}:
+		if newTyped, ok := newValue.(map[string]interface{}); ok {
+			return compareMaps(path, fieldPath, oldTyped, newTyped, keys, changes)
+		}
+
+	case []interface{}:
+		if newTyped, ok := newValue.([]interface{}); ok {
+			return compareLists(path, fieldPath, oldTyped, newTyped, keys, changes)
+		}
+	}
+
+	if reflect.DeepEqual(oldValue, newValue) {
+		return changes
+	}
+
+	return append(changes, fieldChange{Type: fieldChanged, Path: path, Old: oldValue, New: newValue})
+}
+
+func compareMaps(path string, fieldPath []string, oldMap, newMap map[string]interface{}, keys listKeyFunc, changes []fieldChange) []fieldChange {
+	allKeys := map[string]struct{}{}
+	for key := range oldMap {
+		allKeys[key] = struct{}{}
+	}
+	for key := range newMap {
+		allKeys[key] = struct{}{}
+	}
+
+	for _, key := range sortedKeys(allKeys) {
+		keyPath := joinFieldPath(path, key)
+		oldChild, oldExists := oldMap[key]
+		newChild, newExists := newMap[key]
+
+		switch {
+		case !oldExists:
+			changes = leafChanges(fieldAdded, keyPath, newChild, changes)
+		case !newExists:
+			changes = leafChanges(fieldRemoved, keyPath, oldChild, changes)
+		default:
+			changes = compareValues(keyPath, childPath(fieldPath, key), oldChild, newChild, keys, changes)
+		}
+	}
+
+	return changes
+}
+
+func compareLists(path string, fieldPath []string, oldList, newList []interface{}, keys listKeyFunc, changes []fieldChange) []fieldChange {
+	if keys != nil {
+		if itemKeys := keys(fieldPath, oldList, newList); len(itemKeys) > 0 {
+			return compareKeyedLists(path, fieldPath, oldList, newList, itemKeys, keys, changes)
+		}
+	}
+
+	for i := 0; i < max(len(oldList), len(newList)); i++ {
+		itemPath := fmt.Sprintf("%s[%d]", path, i)
+
+		switch {
+		case i >= len(oldList):
+			changes = leafChanges(fieldAdded, itemPath, newList[i], changes)
+		case i >= len(newList):
+			changes = leafChanges(fieldRemoved, itemPath, oldList[i], changes)
+		default:
+			changes = compareValues(itemPath, fieldPath, oldList[i], newList[i], keys, changes)
+		}
+	}
+
+	return changes
+}
+
+// compareKeyedLists matches list items by their keys, so that items are
+// reported as "containers[name=app].image" instead of by their index.
+func compareKeyedLists(path string, fieldPath []string, oldList, newList []interface{}, itemKeys []string, keys listKeyFunc, changes []fieldChange) []fieldChange {
+	oldIndex := indexItems(oldList, itemKeys)
+	newIndex := indexItems(newList, itemKeys)
+
+	for _, oldItem := range oldList {
+		key, _ := itemKey(oldItem, itemKeys)
+		itemPath := fmt.Sprintf("%s[%s]", path, key)
+
+		if j, exists := newIndex[key]; exists {
+			changes = compareValues(itemPath, fieldPath, oldItem, newList[j], keys, changes)
+		} else {
+			changes = append(changes, fieldChange{Type: fieldRemoved, Path: itemPath, Old: oldItem})
+		}
+	}
+
+	for _, newItem := range newList {
+		key, _ := itemKey(newItem, itemKeys)
+
+		if _, exists := oldIndex[key]; !exists {
+			changes = append(changes, fieldChange{Type: fieldAdded, Path: fmt.Sprintf("%s[%s]", path, key), New: newItem})
+		}
+	}
+
+	return changes
+}
+
+// leafChanges reports every leaf of the given value as added or removed.
+// Empty maps and lists are reported as leaves themselves.
+func leafChanges(changeType fieldChangeType, path string, value interface{}, changes []fieldChange) []fieldChange {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		if len(typed) > 0 {
+			keys := map[string]struct{}{}
+			for key := range typed {
+				keys[key] = struct{}{}
+			}
+
+			for _, key := range sortedKeys(keys) {
+				changes = leafChanges(changeType, joinFieldPath(path, key), typed[key], changes)
+			}
+
+			return changes
+		}
+
+	case []interface{}:
+		if len(typed) > 0 {
+			for i, item := range typed {
+				changes = leafChanges(changeType, fmt.Sprintf("%s[%d]", path, i), item, changes)
+			}
+
+			return changes
+		}
+	}
+
+	change := fieldChange{Type: changeType, Path: path}
+	if changeType == fieldAdded {
+		change.New = value
+	} else {
+		change.Old = value
+	}
+
+	return append(changes, change)
+}
+
+func sortedKeys(keys map[string]struct{}) []string {
+	result := []string{}
+	for key := range keys {
+		result = append(result, key)
+	}
+
+	sort.Strings(result)
+
+	return result
+}
+
+// joinFieldPath appends the key to the path, using the ["key"] notation for
+// keys that contain dots or brackets (like most annotations).
+func joinFieldPath(path string, key string) string {
+	if strings.ContainsAny(key, ".[]\"") {
+		return fmt.Sprintf("%s[%q]", path, key)
+	}
+
+	if path == "" {
+		return key
+	}
+
+	return path + "." + key
+}
+
+// renderFields renders the field changes, one line per changed leaf. If
+// owners is given, the managers owning each field are shown as well.
+func renderFields(changes []fieldChange, titleA, titleB string, contextLines int, theme map[cdiff.Tag]color.Style, owners func(fieldChange) []string) string {
+	var builder strings.Builder
+
+	headerStyle := theme[cdiff.OpenHeader]
+	deletedStyle := theme[cdiff.OpenDeletedNotModified]
+	insertedStyle := theme[cdiff.OpenInsertedNotModified]
+
+	builder.WriteString(headerStyle.Sprint("--- " + titleA))
+	builder.WriteString("\n")
+	builder.WriteString(headerStyle.Sprint("+++ " + titleB))
+	builder.WriteString("\n")
+
+	for _, change := range changes {
+		path := change.Path
+		if path == "" {
+			path = "."
+		}
+
+		builder.WriteString(path)
+		builder.WriteString(":")
+
+		// multi-line strings like embedded config files get their own diff
+		if change.Type == fieldChanged && isMultiline(change.Old) && isMultiline(change.New) {
+			writeOwners(&builder, change, owners, theme)
+			builder.WriteString("\n")
+			renderLineDiff(&builder, change.Old.(string), change.New.(string), contextLines, theme)
+
+			continue
+		}
+
+		builder.WriteString(" ")
+
+		switch change.Type {
+		case fieldAdded:
+			builder.WriteString(insertedStyle.Sprint("added " + formatFieldValue(change.New)))
+
+		case fieldRemoved:
+			builder.WriteString(deletedStyle.Sprint("removed " + formatFieldValue(change.Old)))
+
+		default:
+			builder.WriteString(deletedStyle.Sprint(formatFieldValue(change.Old)))
+			builder.WriteString(" → ")
+			builder.WriteString(insertedStyle.Sprint(formatFieldValue(change.New)))
+
+			if oldType, newType := fieldValueType(change.Old), fieldValueType(change.New); oldType != newType {
+				builder.WriteString(fmt.Sprintf(" (%s → %s)", oldType, newType))
+			}
+		}
+
+		writeOwners(&builder, change, owners, theme)
+		builder.WriteString("\n")
+	}
+
+	return builder.String()
+}
+
+func writeOwners(builder *strings.Builder, change fieldChange, owners func(fieldChange) []string, theme map[cdiff.Tag]color.Style) {
+	if owners == nil {
+		return
+	}
+
+	if managers := owners(change); len(managers) > 0 {
+		builder.WriteString(theme[cdiff.OpenSection].Sprintf(" [%s]", strings.Join(managers, ", ")))
+	}
+}
+
+func formatFieldValue(value interface{}) string {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+
+	return string(encoded)
+}
+
+func fieldValueType(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case bool:
+		return "bool"
+	case int64, float64:
+		return "number"
+	case map[string]interface{}:
+		return "map"
+	case []interface{}:
+		return "list"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
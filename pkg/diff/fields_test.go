@@ -0,0 +1,130 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package diff
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestCompareFields(t *testing.T) {
+	testcases := []struct {
+		name      string
+		old       interface{}
+		new       interface{}
+		matchKeys bool
+		expected  []fieldChange
+	}{
+		{
+			name:     "no changes",
+			old:      map[string]interface{}{"a": int64(1)},
+			new:      map[string]interface{}{"a": int64(1)},
+			expected: nil,
+		},
+		{
+			name: "changed value",
+			old:  map[string]interface{}{"spec": map[string]interface{}{"replicas": int64(2)}},
+			new:  map[string]interface{}{"spec": map[string]interface{}{"replicas": int64(3)}},
+			expected: []fieldChange{
+				{Type: fieldChanged, Path: "spec.replicas", Old: int64(2), New: int64(3)},
+			},
+		},
+		{
+			name: "added and removed keys",
+			old:  map[string]interface{}{"labels": map[string]interface{}{"app": "foo"}},
+			new:  map[string]interface{}{"labels": map[string]interface{}{"version": "v2"}},
+			expected: []fieldChange{
+				{Type: fieldRemoved, Path: "labels.app", Old: "foo"},
+				{Type: fieldAdded, Path: "labels.version", New: "v2"},
+			},
+		},
+		{
+			name: "added maps are reported leaf by leaf",
+			old:  map[string]interface{}{},
+			new:  map[string]interface{}{"a": map[string]interface{}{"b": "c", "d": map[string]interface{}{}}},
+			expected: []fieldChange{
+				{Type: fieldAdded, Path: "a.b", New: "c"},
+				{Type: fieldAdded, Path: "a.d", New: map[string]interface{}{}},
+			},
+		},
+		{
+			name: "lists",
+			old:  map[string]interface{}{"args": []interface{}{"a", "b"}},
+			new:  map[string]interface{}{"args": []interface{}{"a", "c", "d"}},
+			expected: []fieldChange{
+				{Type: fieldChanged, Path: "args[1]", Old: "b", New: "c"},
+				{Type: fieldAdded, Path: "args[2]", New: "d"},
+			},
+		},
+		{
+			name: "keyed lists",
+			old: map[string]interface{}{"env": []interface{}{
+				map[string]interface{}{"name": "gone", "value": "9"},
+				map[string]interface{}{"name": "a", "value": "1"},
+				map[string]interface{}{"name": "b", "value": "2"},
+			}},
+			new: map[string]interface{}{"env": []interface{}{
+				map[string]interface{}{"name": "new", "value": "0"},
+				map[string]interface{}{"name": "a", "value": "1"},
+				map[string]interface{}{"name": "b", "value": "3"},
+			}},
+			matchKeys: true,
+			// added and removed items are reported once, not per field
+			expected: []fieldChange{
+				{Type: fieldRemoved, Path: `env[name="gone"]`, Old: map[string]interface{}{"name": "gone", "value": "9"}},
+				{Type: fieldChanged, Path: `env[name="b"].value`, Old: "2", New: "3"},
+				{Type: fieldAdded, Path: `env[name="new"]`, New: map[string]interface{}{"name": "new", "value": "0"}},
+			},
+		},
+		{
+			name: "type changes",
+			old:  map[string]interface{}{"a": "3", "b": map[string]interface{}{"c": "d"}},
+			new:  map[string]interface{}{"a": int64(3), "b": "c"},
+			expected: []fieldChange{
+				{Type: fieldChanged, Path: "a", Old: "3", New: int64(3)},
+				{Type: fieldChanged, Path: "b", Old: map[string]interface{}{"c": "d"}, New: "c"},
+			},
+		},
+		{
+			name: "keys with dots",
+			old:  map[string]interface{}{"annotations": map[string]interface{}{"example.com/foo": "a"}},
+			new:  map[string]interface{}{"annotations": map[string]interface{}{"example.com/foo": "b"}},
+			expected: []fieldChange{
+				{Type: fieldChanged, Path: `annotations["example.com/foo"]`, Old: "a", New: "b"},
+			},
+		},
+		{
+			name: "created object",
+			old:  nil,
+			new:  map[string]interface{}{"a": "b"},
+			expected: []fieldChange{
+				{Type: fieldAdded, Path: "a", New: "b"},
+			},
+		},
+		{
+			name: "scalar documents",
+			old:  "Pending",
+			new:  "Running",
+			expected: []fieldChange{
+				{Type: fieldChanged, Path: "", Old: "Pending", New: "Running"},
+			},
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			var keys listKeyFunc
+			if testcase.matchKeys {
+				keys = (&Differ{}).listKeys(schema.GroupVersionKind{}, &Options{MatchListItems: true})
+			}
+
+			changes := compareFields(testcase.old, testcase.new, keys)
+			if !reflect.DeepEqual(changes, testcase.expected) {
+				t.Errorf("Expected %+v, but got %+v.", testcase.expected, changes)
+			}
+		})
+	}
+}
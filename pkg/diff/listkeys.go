@@ -0,0 +1,291 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package diff
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// ListKeyResolver returns the fields that identify items in a list (like
+// "name" for containers), usually based on the x-kubernetes-list-map-keys
+// in the cluster's OpenAPI schema. The path contains the field names leading
+// to the list, without list indices (e.g. [spec template spec containers]).
+type ListKeyResolver interface {
+	ListKeys(gvk schema.GroupVersionKind, path []string) []string
+}
+
+// knownListKeys are the patch merge keys of common Kubernetes lists, by the
+// name of the list field. Each list can have multiple candidates, the first
+// one that all items have is used.
+var knownListKeys = map[string][][]string{
+	"addresses":                  {{"type"}, {"ip"}},
+	"conditions":                 {{"type"}},
+	"containerStatuses":          {{"name"}},
+	"containers":                 {{"name"}},
+	"env":                        {{"name"}},
+	"ephemeralContainers":        {{"name"}},
+	"ephemeralContainerStatuses": {{"name"}},
+	"hostAliases":                {{"ip"}},
+	"imagePullSecrets":           {{"name"}},
+	"initContainerStatuses":      {{"name"}},
+	"initContainers":             {{"name"}},
+	"ownerReferences":            {{"uid"}},
+	"ports":                      {{"containerPort", "protocol"}, {"containerPort"}, {"port", "protocol"}, {"port"}},
+	"taints":                     {{"key", "effect"}},
+	"topologySpreadConstraints":  {{"topologyKey", "whenUnsatisfiable"}},
+	"volumeDevices":              {{"devicePath"}},
+	"volumeMounts":               {{"mountPath"}},
+	"volumes":                    {{"name"}},
+}
+
+// listKeyFunc returns the fields that identify the items of the list at the
+// given path or nil if the list items cannot be matched by key.
+type listKeyFunc func(path []string, lists ...[]interface{}) []string
+
+// listKeys returns the function to determine list keys with for objects of
+// the given kind, or nil if list items should not be matched.
+func (d *Differ) listKeys(gvk schema.GroupVersionKind, opt *Options) listKeyFunc {
+	if !opt.MatchListItems {
+		return nil
+	}
+
+	// schema paths do not apply if the JSONPath selected only a part of the object
+	resolver := opt.ListKeyResolver
+	if opt.compiledJSONPath != nil {
+		resolver = nil
+	}
+
+	return func(path []string, lists ...[]interface{}) []string {
+		if resolver != nil {
+			if keys := resolver.ListKeys(gvk, path); len(keys) > 0 && hasUniqueKeys(keys, lists...) {
+				return keys
+			}
+		}
+
+		if len(path) == 0 {
+			return nil
+		}
+
+		for _, keys := range knownListKeys[path[len(path)-1]] {
+			if hasUniqueKeys(keys, lists...) {
+				return keys
+			}
+		}
+
+		return nil
+	}
+}
+
+// hasUniqueKeys checks if all items in each list are maps that have all key
+// fields and no two items in the same list share the same key.
+func hasUniqueKeys(keys []string, lists ...[]interface{}) bool {
+	for _, list := range lists {
+		seen := map[string]struct{}{}
+
+		for _, item := range list {
+			key, ok := itemKey(item, keys)
+			if !ok {
+				return false
+			}
+
+			if _, exists := seen[key]; exists {
+				return false
+			}
+
+			seen[key] = struct{}{}
+		}
+	}
+
+	return true
+}
+
+// itemKey returns the key of a list item, like `name="app"` or
+// `containerPort=80,protocol="TCP"`. Values are JSON encoded, so that values
+// containing commas or equal signs cannot be confused with other keys.
+func itemKey(item interface{}, keys []string) (string, bool) {
+	obj, ok := item.(map[string]interface{})
+	if !ok {
+		return "", false
+	}
+
+	parts := []string{}
+	for _, key := range keys {
+		value, exists := obj[key]
+		if !exists {
+			return "", false
+		}
+
+		var buf bytes.Buffer
+
+		encoder := json.NewEncoder(&buf)
+		encoder.SetEscapeHTML(false)
+
+		if err := encoder.Encode(value); err != nil {
+			return "", false
+		}
+
+		parts = append(parts, fmt.Sprintf("%s=%s", key, strings.TrimSuffix(buf.String(), "\n")))
+	}
+
+	return strings.Join(parts, ","), true
+}
+
+// alignLists rearranges the lists in the new value so that items that have
+// the same key as items in the old value appear in the same order as in the
+// old value. This way a text diff only shows items that were actually added,
+// removed or changed. If ignoreOrder is set, lists without keys are sorted
+// in both values. Both values are modified in place and returned.
+func alignLists(oldValue, newValue interface{}, keys listKeyFunc, ignoreOrder bool) (interface{}, interface{}) {
+	return alignValues(nil, oldValue, newValue, keys, ignoreOrder)
+}
+
+func alignValues(path []string, oldValue, newValue interface{}, keys listKeyFunc, ignoreOrder bool) (interface{}, interface{}) {
+	switch oldTyped := oldValue.(type) {
+	case map[string]interface{}:
+		newTyped, ok := newValue.(map[string]interface{})
+		if !ok {
+			break
+		}
+
+		for key, oldChild := range oldTyped {
+			if newChild, exists := newTyped[key]; exists {
+				oldTyped[key], newTyped[key] = alignValues(childPath(path, key), oldChild, newChild, keys, ignoreOrder)
+			}
+		}
+
+		return oldTyped, newTyped
+
+	case []interface{}:
+		newTyped, ok := newValue.([]interface{})
+		if !ok {
+			break
+		}
+
+		var itemKeys []string
+		if keys != nil {
+			itemKeys = keys(path, oldTyped, newTyped)
+		}
+
+		if len(itemKeys) > 0 {
+			newTyped = alignItems(oldTyped, newTyped, itemKeys)
+			oldIndex := indexItems(oldTyped, itemKeys)
+
+			for i, newItem := range newTyped {
+				key, _ := itemKey(newItem, itemKeys)
+				if j, exists := oldIndex[key]; exists {
+					oldTyped[j], newTyped[i] = alignValues(path, oldTyped[j], newItem, keys, ignoreOrder)
+				}
+			}
+
+			return oldTyped, newTyped
+		}
+
+		if ignoreOrder {
+			sortItems(oldTyped)
+			sortItems(newTyped)
+		}
+
+		for i := 0; i < min(len(oldTyped), len(newTyped)); i++ {
+			oldTyped[i], newTyped[i] = alignValues(path, oldTyped[i], newTyped[i], keys, ignoreOrder)
+		}
+
+		return oldTyped, newTyped
+	}
+
+	return oldValue, newValue
+}
+
+// alignItems returns the new items in the order of the old items. Items that
+// only exist in the new list are kept right after the item they followed in
+// the new list.
+func alignItems(oldItems, newItems []interface{}, keys []string) []interface{} {
+	oldIndex := indexItems(oldItems, keys)
+
+	// remember for every added item after which existing item it appeared
+	var leading []interface{}
+	following := map[string][]interface{}{}
+	anchor := ""
+
+	newIndex := map[string]interface{}{}
+	for _, item := range newItems {
+		key, _ := itemKey(item, keys)
+
+		if _, exists := oldIndex[key]; exists {
+			newIndex[key] = item
+			anchor = key
+			continue
+		}
+
+		if anchor == "" {
+			leading = append(leading, item)
+		} else {
+			following[anchor] = append(following[anchor], item)
+		}
+	}
+
+	result := make([]interface{}, 0, len(newItems))
+	result = append(result, leading...)
+
+	for _, item := range oldItems {
+		key, _ := itemKey(item, keys)
+
+		if newItem, exists := newIndex[key]; exists {
+			result = append(result, newItem)
+			result = append(result, following[key]...)
+		}
+	}
+
+	return result
+}
+
+// childPath returns a copy of the path with the given field appended.
+func childPath(path []string, field string) []string {
+	return append(append([]string{}, path...), field)
+}
+
+func indexItems(items []interface{}, keys []string) map[string]int {
+	index := map[string]int{}
+	for i, item := range items {
+		if key, ok := itemKey(item, keys); ok {
+			index[key] = i
+		}
+	}
+
+	return index
+}
+
+// sortItems sorts list items by their JSON representation.
+func sortItems(items []interface{}) {
+	encoded := make([]string, len(items))
+	for i, item := range items {
+		data, _ := json.Marshal(item)
+		encoded[i] = string(data)
+	}
+
+	sort.Sort(&itemSorter{items: items, encoded: encoded})
+}
+
+type itemSorter struct {
+	items   []interface{}
+	encoded []string
+}
+
+func (s *itemSorter) Len() int {
+	return len(s.items)
+}
+
+func (s *itemSorter) Less(i, j int) bool {
+	return s.encoded[i] < s.encoded[j]
+}
+
+func (s *itemSorter) Swap(i, j int) {
+	s.items[i], s.items[j] = s.items[j], s.items[i]
+	s.encoded[i], s.encoded[j] = s.encoded[j], s.encoded[i]
+}
@@ -0,0 +1,177 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package diff
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/yaml"
+)
+
+type staticListKeys map[string][]string
+
+func (s staticListKeys) ListKeys(gvk schema.GroupVersionKind, path []string) []string {
+	return s[path[len(path)-1]]
+}
+
+func TestAlignLists(t *testing.T) {
+	testcases := []struct {
+		name        string
+		opt         Options
+		old         string
+		new         string
+		expectedOld string
+		expectedNew string
+	}{
+		{
+			name:        "inserted items stay where they were inserted",
+			opt:         Options{MatchListItems: true},
+			old:         `{env: [{name: a}, {name: b}]}`,
+			new:         `{env: [{name: a}, {name: new}, {name: b}]}`,
+			expectedOld: `{env: [{name: a}, {name: b}]}`,
+			expectedNew: `{env: [{name: a}, {name: new}, {name: b}]}`,
+		},
+		{
+			name:        "reordered items are aligned",
+			opt:         Options{MatchListItems: true},
+			old:         `{conditions: [{type: Ready, status: "True"}, {type: Progressing}]}`,
+			new:         `{conditions: [{type: Progressing}, {type: Ready, status: "False"}]}`,
+			expectedOld: `{conditions: [{type: Ready, status: "True"}, {type: Progressing}]}`,
+			expectedNew: `{conditions: [{type: Ready, status: "False"}, {type: Progressing}]}`,
+		},
+		{
+			name:        "nested lists are aligned",
+			opt:         Options{MatchListItems: true},
+			old:         `{containers: [{name: a, ports: [{containerPort: 80}, {containerPort: 443}]}, {name: b}]}`,
+			new:         `{containers: [{name: b}, {name: a, ports: [{containerPort: 443}, {containerPort: 80}]}]}`,
+			expectedOld: `{containers: [{name: a, ports: [{containerPort: 80}, {containerPort: 443}]}, {name: b}]}`,
+			expectedNew: `{containers: [{name: a, ports: [{containerPort: 80}, {containerPort: 443}]}, {name: b}]}`,
+		},
+		{
+			name:        "items without unique keys are not touched",
+			opt:         Options{MatchListItems: true},
+			old:         `{env: [{name: a}, {name: a}]}`,
+			new:         `{env: [{name: b}, {name: a}]}`,
+			expectedOld: `{env: [{name: a}, {name: a}]}`,
+			expectedNew: `{env: [{name: b}, {name: a}]}`,
+		},
+		{
+			name:        "matching can be disabled",
+			opt:         Options{},
+			old:         `{env: [{name: a}, {name: b}]}`,
+			new:         `{env: [{name: b}, {name: a}]}`,
+			expectedOld: `{env: [{name: a}, {name: b}]}`,
+			expectedNew: `{env: [{name: b}, {name: a}]}`,
+		},
+		{
+			name:        "keys from the resolver take precedence",
+			opt:         Options{MatchListItems: true, ListKeyResolver: staticListKeys{"items": {"id"}}},
+			old:         `{items: [{id: 1}, {id: 2}]}`,
+			new:         `{items: [{id: 2}, {id: 1}]}`,
+			expectedOld: `{items: [{id: 1}, {id: 2}]}`,
+			expectedNew: `{items: [{id: 1}, {id: 2}]}`,
+		},
+		{
+			name:        "ignoring the order sorts lists without keys",
+			opt:         Options{MatchListItems: true, IgnoreOrder: true},
+			old:         `{finalizers: [b, a], env: [{name: x}, {name: y}]}`,
+			new:         `{finalizers: [a, c, b], env: [{name: y}, {name: x}]}`,
+			expectedOld: `{finalizers: [a, b], env: [{name: x}, {name: y}]}`,
+			expectedNew: `{finalizers: [a, b, c], env: [{name: x}, {name: y}]}`,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			differ, err := NewDiffer(&testcase.opt, logrus.New())
+			if err != nil {
+				t.Fatalf("Failed to create differ: %v", err)
+			}
+
+			opt := differ.optionsFor(schema.GroupVersionKind{})
+			oldData, newData := alignLists(parseYAML(t, testcase.old), parseYAML(t, testcase.new), differ.listKeys(schema.GroupVersionKind{}, opt), opt.IgnoreOrder)
+
+			if expected := parseYAML(t, testcase.expectedOld); !reflect.DeepEqual(oldData, expected) {
+				t.Errorf("Expected old value to be %v, but got %v.", expected, oldData)
+			}
+
+			if expected := parseYAML(t, testcase.expectedNew); !reflect.DeepEqual(newData, expected) {
+				t.Errorf("Expected new value to be %v, but got %v.", expected, newData)
+			}
+		})
+	}
+}
+
+func parseYAML(t *testing.T, data string) interface{} {
+	var result interface{}
+	if err := yaml.Unmarshal([]byte(data), &result); err != nil {
+		t.Fatalf("Failed to parse %q: %v", data, err)
+	}
+
+	return result
+}
+
+func TestItemKey(t *testing.T) {
+	testcases := []struct {
+		name     string
+		item     string
+		keys     []string
+		expected string
+		ok       bool
+	}{
+		{
+			name:     "single key",
+			item:     `{name: app, image: nginx}`,
+			keys:     []string{"name"},
+			expected: `name="app"`,
+			ok:       true,
+		},
+		{
+			name:     "multiple keys",
+			item:     `{containerPort: 80, protocol: TCP}`,
+			keys:     []string{"containerPort", "protocol"},
+			expected: `containerPort=80,protocol="TCP"`,
+			ok:       true,
+		},
+		{
+			name:     "separators in values",
+			item:     `{a: "x,b=y", b: z}`,
+			keys:     []string{"a", "b"},
+			expected: `a="x,b=y",b="z"`,
+			ok:       true,
+		},
+		{
+			name:     "special characters are not escaped",
+			item:     `{name: "a&b<c>"}`,
+			keys:     []string{"name"},
+			expected: `name="a&b<c>"`,
+			ok:       true,
+		},
+		{
+			name: "missing key",
+			item: `{name: app}`,
+			keys: []string{"name", "namespace"},
+			ok:   false,
+		},
+		{
+			name: "scalar item",
+			item: `app`,
+			keys: []string{"name"},
+			ok:   false,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			key, ok := itemKey(parseYAML(t, testcase.item), testcase.keys)
+			if ok != testcase.ok || key != testcase.expected {
+				t.Errorf("Expected (%q, %v), but got (%q, %v).", testcase.expected, testcase.ok, key, ok)
+			}
+		})
+	}
+}
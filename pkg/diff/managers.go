@@ -0,0 +1,285 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package diff
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// changedManagers returns the field managers whose managedFields entries
+// were added or changed between both versions of an object. No managers are
+// returned if no entry changed (the apiserver only tracks times with second
+// precision), see probableManager.
+func changedManagers(oldObj, newObj *unstructured.Unstructured) []string {
+	if newObj == nil {
+		return nil
+	}
+
+	oldEntries := map[string]metav1.ManagedFieldsEntry{}
+	if oldObj != nil {
+		for _, entry := range oldObj.GetManagedFields() {
+			oldEntries[managedFieldsKey(entry)] = entry
+		}
+	}
+
+	managers := map[string]struct{}{}
+	for _, entry := range newObj.GetManagedFields() {
+		oldEntry, exists := oldEntries[managedFieldsKey(entry)]
+		if !exists || !sameManagedFields(oldEntry, entry) {
+			managers[entry.Manager] = struct{}{}
+		}
+	}
+
+	if len(managers) == 0 {
+		return nil
+	}
+
+	return sortedKeys(managers)
+}
+
+// probableManager returns the most recently active manager of the object, as
+// a guess for who made a change whose managers could not be detected.
+func probableManager(managers []string, newObj *unstructured.Unstructured) string {
+	if len(managers) > 0 || newObj == nil {
+		return ""
+	}
+
+	return latestFieldManager(newObj.GetManagedFields())
+}
+
+func managedFieldsKey(entry metav1.ManagedFieldsEntry) string {
+	return fmt.Sprintf("%s/%s/%s", entry.Manager, entry.Operation, entry.Subresource)
+}
+
+func sameManagedFields(a, b metav1.ManagedFieldsEntry) bool {
+	if (a.Time == nil) != (b.Time == nil) || (a.Time != nil && !a.Time.Equal(b.Time)) {
+		return false
+	}
+
+	if (a.FieldsV1 == nil) != (b.FieldsV1 == nil) {
+		return false
+	}
+
+	return a.FieldsV1 == nil || bytes.Equal(a.FieldsV1.Raw, b.FieldsV1.Raw)
+}
+
+// matchesManagers returns true if any of the managers matches any of the
+// patterns (which can contain globs like "kubectl*").
+func matchesManagers(managers []string, patterns []string) bool {
+	for _, manager := range managers {
+		for _, pattern := range patterns {
+			if matched, _ := filepath.Match(pattern, manager); matched {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// fieldOwnership maps field paths (in the same notation as fieldChange
+// paths) to the managers that own them.
+type fieldOwnership map[string][]string
+
+// newFieldOwnership parses the managedFields of the object.
+func newFieldOwnership(obj *unstructured.Unstructured, keys listKeyFunc) fieldOwnership {
+	owners := fieldOwnership{}
+	if obj == nil {
+		return owners
+	}
+
+	for _, entry := range obj.GetManagedFields() {
+		if entry.FieldsV1 == nil {
+			continue
+		}
+
+		var fields map[string]interface{}
+		if err := json.Unmarshal(entry.FieldsV1.Raw, &fields); err != nil {
+			continue
+		}
+
+		owners.add(entry.Manager, "", nil, fields, keys)
+	}
+
+	return owners
+}
+
+// add walks the FieldsV1 set (e.g. {"f:spec": {"f:replicas": {}}}) and
+// records the manager for every owned field.
+func (o fieldOwnership) add(manager string, path string, fieldPath []string, fields map[string]interface{}, keys listKeyFunc) {
+	for segment, children := range fields {
+		var (
+			itemPath      string
+			itemFieldPath = fieldPath
+		)
+
+		switch {
+		case segment == ".":
+			o.own(path, manager)
+			continue
+
+		case strings.HasPrefix(segment, "f:"):
+			name := strings.TrimPrefix(segment, "f:")
+			itemPath = joinFieldPath(path, name)
+			itemFieldPath = childPath(fieldPath, name)
+
+		case strings.HasPrefix(segment, "k:"):
+			key, ok := managedItemKey(strings.TrimPrefix(segment, "k:"), fieldPath, keys)
+			if !ok {
+				o.own(path, manager)
+				continue
+			}
+
+			itemPath = fmt.Sprintf("%s[%s]", path, key)
+
+		default:
+			// items identified by value ("v:") or index ("i:") cannot be
+			// mapped to paths, so the list is owned as a whole
+			o.own(path, manager)
+			continue
+		}
+
+		childFields, _ := children.(map[string]interface{})
+		if len(childFields) == 0 {
+			o.own(itemPath, manager)
+		} else {
+			o.add(manager, itemPath, itemFieldPath, childFields, keys)
+		}
+	}
+}
+
+func (o fieldOwnership) own(path string, manager string) {
+	for _, existing := range o[path] {
+		if existing == manager {
+			return
+		}
+	}
+
+	o[path] = append(o[path], manager)
+	sort.Strings(o[path])
+}
+
+// owners returns the managers of the path or of its closest owned parent.
+func (o fieldOwnership) owners(path string) []string {
+	if managers, exists := o[path]; exists {
+		return managers
+	}
+
+	boundaries := pathBoundaries(path)
+	for i := len(boundaries) - 1; i >= 0; i-- {
+		if managers, exists := o[path[:boundaries[i]]]; exists {
+			return managers
+		}
+	}
+
+	return nil
+}
+
+// fieldOwners returns a function that returns the owners of a changed field;
+// removed fields are owned by the managers of the old object.
+func fieldOwners(oldObj, newObj *unstructured.Unstructured, keys listKeyFunc) func(fieldChange) []string {
+	oldOwners := newFieldOwnership(oldObj, keys)
+	newOwners := newFieldOwnership(newObj, keys)
+
+	return func(change fieldChange) []string {
+		if change.Type == fieldRemoved {
+			return oldOwners.owners(change.Path)
+		}
+
+		return newOwners.owners(change.Path)
+	}
+}
+
+// managedItemKey turns the key of a list item in managedFields (like
+// {"containerPort":80,"protocol":"TCP"}) into the notation used by itemKey.
+func managedItemKey(raw string, fieldPath []string, keys listKeyFunc) (string, bool) {
+	var values map[string]interface{}
+	if err := json.Unmarshal([]byte(raw), &values); err != nil {
+		return "", false
+	}
+
+	names := []string{}
+	for name := range values {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	// prefer the same order as the list keys used for comparing the lists
+	if keys != nil {
+		if listKeys := keys(fieldPath); len(listKeys) == len(names) {
+			ordered := true
+			for _, key := range listKeys {
+				if _, exists := values[key]; !exists {
+					ordered = false
+				}
+			}
+
+			if ordered {
+				names = listKeys
+			}
+		}
+	}
+
+	return itemKey(values, names)
+}
+
+// pathBoundaries returns the positions at which the segments of a field
+// path start, ignoring dots and brackets inside of brackets and quotes.
+func pathBoundaries(path string) []int {
+	boundaries := []int{}
+	depth := 0
+	quoted := false
+
+	for i, r := range path {
+		switch {
+		case quoted:
+			if r == '"' && path[i-1] != '\\' {
+				quoted = false
+			}
+		case r == '"':
+			quoted = true
+		case r == '[':
+			if depth == 0 && i > 0 {
+				boundaries = append(boundaries, i)
+			}
+			depth++
+		case r == ']':
+			depth--
+		case r == '.' && depth == 0:
+			boundaries = append(boundaries, i)
+		}
+	}
+
+	return boundaries
+}
+
+// renderOwners lists the managers of each changed field, for layouts that do
+// not show field paths themselves.
+func renderOwners(changes []fieldChange, owners func(fieldChange) []string) string {
+	var builder strings.Builder
+
+	for _, change := range changes {
+		managers := owners(change)
+		if len(managers) == 0 {
+			continue
+		}
+
+		if builder.Len() == 0 {
+			builder.WriteString("Field managers:\n")
+		}
+
+		builder.WriteString(fmt.Sprintf("  %s: %s\n", change.Path, strings.Join(managers, ", ")))
+	}
+
+	return builder.String()
+}
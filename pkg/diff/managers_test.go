@@ -0,0 +1,193 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package diff
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+type testEntry struct {
+	manager string
+	minute  int
+	fields  string
+}
+
+func managedObject(entries ...testEntry) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion("apps/v1")
+	obj.SetKind("Deployment")
+	obj.SetName("test")
+
+	managedFields := []metav1.ManagedFieldsEntry{}
+	for _, entry := range entries {
+		timestamp := metav1.NewTime(time.Date(2024, 1, 1, 10, entry.minute, 0, 0, time.UTC))
+
+		managedFields = append(managedFields, metav1.ManagedFieldsEntry{
+			Manager:    entry.manager,
+			Operation:  metav1.ManagedFieldsOperationUpdate,
+			Time:       &timestamp,
+			FieldsType: "FieldsV1",
+			FieldsV1:   &metav1.FieldsV1{Raw: []byte(entry.fields)},
+		})
+	}
+
+	obj.SetManagedFields(managedFields)
+
+	return obj
+}
+
+func TestChangedManagers(t *testing.T) {
+	testcases := []struct {
+		name     string
+		old      *unstructured.Unstructured
+		new      *unstructured.Unstructured
+		expected []string
+	}{
+		{
+			name:     "new objects are attributed to all managers",
+			old:      nil,
+			new:      managedObject(testEntry{"helm", 0, `{}`}, testEntry{"kube-controller-manager", 1, `{}`}),
+			expected: []string{"helm", "kube-controller-manager"},
+		},
+		{
+			name:     "only changed entries are considered",
+			old:      managedObject(testEntry{"helm", 0, `{}`}, testEntry{"kubectl", 1, `{}`}),
+			new:      managedObject(testEntry{"helm", 0, `{}`}, testEntry{"kubectl", 2, `{}`}),
+			expected: []string{"kubectl"},
+		},
+		{
+			name:     "new entries are considered",
+			old:      managedObject(testEntry{"helm", 0, `{}`}),
+			new:      managedObject(testEntry{"helm", 0, `{}`}, testEntry{"kubectl", 0, `{}`}),
+			expected: []string{"kubectl"},
+		},
+		{
+			name:     "entries that lost fields are considered",
+			old:      managedObject(testEntry{"helm", 0, `{"f:spec":{"f:replicas":{}}}`}, testEntry{"kubectl", 0, `{}`}),
+			new:      managedObject(testEntry{"helm", 0, `{}`}, testEntry{"kubectl", 0, `{}`}),
+			expected: []string{"helm"},
+		},
+		{
+			name:     "no managers are detected if no entry changed",
+			old:      managedObject(testEntry{"helm", 3, `{}`}, testEntry{"kubectl", 1, `{}`}),
+			new:      managedObject(testEntry{"helm", 3, `{}`}, testEntry{"kubectl", 1, `{}`}),
+			expected: nil,
+		},
+		{
+			name:     "deleted objects have no managers",
+			old:      managedObject(testEntry{"helm", 0, `{}`}),
+			new:      nil,
+			expected: nil,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			managers := changedManagers(testcase.old, testcase.new)
+			if !reflect.DeepEqual(testcase.expected, managers) {
+				t.Errorf("Expected %v, but got %v.", testcase.expected, managers)
+			}
+		})
+	}
+}
+
+func TestManagerFilter(t *testing.T) {
+	testcases := []struct {
+		name     string
+		old      *unstructured.Unstructured
+		new      *unstructured.Unstructured
+		expected bool
+	}{
+		{
+			name:     "matching manager",
+			old:      managedObject(testEntry{"helm", 0, `{}`}),
+			new:      managedObject(testEntry{"helm", 0, `{}`}, testEntry{"kubectl-edit", 1, `{}`}),
+			expected: true,
+		},
+		{
+			name:     "other manager",
+			old:      managedObject(testEntry{"kubectl-edit", 0, `{}`}),
+			new:      managedObject(testEntry{"kubectl-edit", 0, `{}`}, testEntry{"helm", 1, `{}`}),
+			expected: false,
+		},
+		{
+			name:     "probable managers are not matched",
+			old:      managedObject(testEntry{"kubectl-edit", 1, `{}`}),
+			new:      managedObject(testEntry{"kubectl-edit", 1, `{}`}),
+			expected: false,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			differ, err := NewDiffer(&Options{Managers: []string{"kubectl*"}}, logrus.New())
+			if err != nil {
+				t.Fatalf("Failed to create differ: %v", err)
+			}
+
+			testcase.new.SetLabels(map[string]string{"changed": "true"})
+
+			event, err := differ.PrintDiff(testcase.old, testcase.new, time.Time{})
+			if err != nil {
+				t.Fatalf("Failed to print diff: %v", err)
+			}
+
+			if printed := event != nil; printed != testcase.expected {
+				t.Errorf("Expected printed to be %v, but got %v.", testcase.expected, printed)
+			}
+		})
+	}
+}
+
+func TestFieldOwnership(t *testing.T) {
+	obj := managedObject(
+		testEntry{"helm", 0, `{
+			"f:metadata": {"f:annotations": {"f:example.com/owner": {}}},
+			"f:spec": {
+				"f:template": {"f:spec": {"f:containers": {
+					"k:{\"name\":\"app\"}": {".": {}, "f:image": {}, "f:name": {}, "f:ports": {
+						"k:{\"protocol\":\"TCP\",\"containerPort\":80}": {".": {}, "f:containerPort": {}}
+					}}
+				}}},
+				"f:finalizers": {"v:\"example\"": {}}
+			}
+		}`},
+		testEntry{"kubectl-scale", 1, `{"f:spec": {"f:replicas": {}}}`},
+		testEntry{"kubectl", 2, `{"f:spec": {"f:replicas": {}}}`},
+	)
+
+	keys := (&Differ{}).listKeys(schema.GroupVersionKind{Kind: "Deployment"}, &Options{MatchListItems: true})
+	ownership := newFieldOwnership(obj, keys)
+
+	testcases := []struct {
+		path     string
+		expected []string
+	}{
+		{path: "spec.replicas", expected: []string{"kubectl", "kubectl-scale"}},
+		{path: `metadata.annotations["example.com/owner"]`, expected: []string{"helm"}},
+		{path: `spec.template.spec.containers[name="app"].image`, expected: []string{"helm"}},
+		{path: `spec.template.spec.containers[name="app"].resources.limits.cpu`, expected: []string{"helm"}},
+		{path: `spec.template.spec.containers[name="app"].ports[containerPort=80,protocol="TCP"].containerPort`, expected: []string{"helm"}},
+		{path: "spec.finalizers[0]", expected: []string{"helm"}},
+		{path: `spec.template.spec.containers[name="sidecar"].image`, expected: nil},
+		{path: "status.replicas", expected: nil},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.path, func(t *testing.T) {
+			owners := ownership.owners(testcase.path)
+			if !reflect.DeepEqual(testcase.expected, owners) {
+				t.Errorf("Expected %v, but got %v.", testcase.expected, owners)
+			}
+		})
+	}
+}
@@ -0,0 +1,172 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package diff
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/gookit/color"
+	"github.com/shibukawa/cdiff"
+)
+
+// blockPlaceholderPrefix is used to mark multi-line strings while encoding
+// objects as YAML. It contains a random part, so that it cannot collide with
+// actual values.
+var blockPlaceholderPrefix = func() string {
+	nonce := make([]byte, 8)
+	if _, err := rand.Read(nonce); err != nil {
+		panic(fmt.Sprintf("failed to generate placeholder: %v", err))
+	}
+
+	return "stalk-block-" + hex.EncodeToString(nonce) + "-"
+}()
+
+func isMultiline(value interface{}) bool {
+	s, ok := value.(string)
+
+	return ok && strings.Contains(s, "\n")
+}
+
+// withBlockPlaceholders returns a copy of the value in which all multi-line
+// strings have been replaced with placeholders; the original strings are
+// stored in blocks.
+func withBlockPlaceholders(value interface{}, blocks map[string]string) interface{} {
+	switch asserted := value.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(asserted))
+		for key, child := range asserted {
+			result[key] = withBlockPlaceholders(child, blocks)
+		}
+
+		return result
+
+	case []interface{}:
+		result := make([]interface{}, len(asserted))
+		for i, item := range asserted {
+			result[i] = withBlockPlaceholders(item, blocks)
+		}
+
+		return result
+
+	case string:
+		if !isMultiline(asserted) {
+			return asserted
+		}
+
+		placeholder := fmt.Sprintf("%s%d", blockPlaceholderPrefix, len(blocks))
+		blocks[placeholder] = asserted
+
+		return placeholder
+	}
+
+	return value
+}
+
+// renderBlockScalars replaces the placeholders in the encoded YAML with
+// literal block scalars. The YAML encoder would otherwise fall back to
+// quoted strings with escaped newlines for values with tabs or trailing
+// spaces, which makes line-based diffs of embedded files impossible.
+func renderBlockScalars(encoded string, blocks map[string]string) string {
+	if len(blocks) == 0 {
+		return encoded
+	}
+
+	lines := strings.Split(encoded, "\n")
+	result := make([]string, 0, len(lines))
+
+	for _, line := range lines {
+		idx := strings.Index(line, blockPlaceholderPrefix)
+		if idx < 0 {
+			result = append(result, line)
+			continue
+		}
+
+		prefix := line[:idx]
+		value, exists := blocks[strings.TrimSpace(line[idx:])]
+		if !exists {
+			result = append(result, line)
+			continue
+		}
+
+		// the block is indented relative to the node it belongs to (the
+		// mapping key or the sequence item)
+		indent := nodeIndentation(prefix) + 2
+
+		result = append(result, prefix+blockHeader(value))
+
+		content := value
+		if strings.HasSuffix(content, "\n") {
+			content = content[:len(content)-1]
+		}
+
+		for _, contentLine := range strings.Split(content, "\n") {
+			if contentLine == "" {
+				result = append(result, "")
+			} else {
+				result = append(result, strings.Repeat(" ", indent)+contentLine)
+			}
+		}
+	}
+
+	return strings.Join(result, "\n")
+}
+
+// nodeIndentation returns the column of the innermost node in a line prefix
+// like "  - name: " or "- - ".
+func nodeIndentation(prefix string) int {
+	rest := strings.TrimLeft(prefix, " ")
+	column := len(prefix) - len(rest)
+
+	for strings.HasPrefix(rest, "- ") && rest != "- " {
+		rest = rest[2:]
+		column += 2
+	}
+
+	return column
+}
+
+// blockHeader returns the header of a literal block scalar ("|", "|-" or
+// "|+"). If the first line starts with a space, the indentation cannot be
+// detected and has to be given explicitly (blocks are always indented by
+// two spaces).
+func blockHeader(value string) string {
+	header := "|"
+
+	firstLine := strings.TrimLeft(value, "\n")
+	if strings.HasPrefix(firstLine, " ") {
+		header += "2"
+	}
+
+	switch {
+	case !strings.HasSuffix(value, "\n"):
+		header += "-"
+	case strings.HasSuffix(value, "\n\n"):
+		header += "+"
+	}
+
+	return header
+}
+
+// renderLineDiff renders a line-based diff of two multi-line strings with its
+// own hunks and context lines, indented below the field it belongs to.
+func renderLineDiff(builder *strings.Builder, oldValue, newValue string, contextLines int, theme map[cdiff.Tag]color.Style) {
+	result := cdiff.Diff(oldValue, newValue, cdiff.WordByWord)
+
+	for _, block := range groupLines(result.Lines, contextLines) {
+		lines := result.Lines[block.start : block.end+1]
+
+		builder.WriteString("  ")
+		builder.WriteString(theme[cdiff.OpenSection].Sprint(sectionHeader(lines)))
+		builder.WriteString("\n")
+
+		for _, line := range lines {
+			builder.WriteString("  ")
+			writeSegments(builder, lineSegments(line, theme))
+			builder.WriteString("\n")
+		}
+	}
+}
@@ -0,0 +1,89 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package diff
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gookit/color"
+	"github.com/shibukawa/cdiff"
+
+	"sigs.k8s.io/yaml"
+)
+
+func TestEncodeYAMLBlockScalars(t *testing.T) {
+	testcases := []struct {
+		name     string
+		value    interface{}
+		expected string
+	}{
+		{
+			name:     "tabs and trailing spaces",
+			value:    map[string]interface{}{"conf": "server {\n\tlisten 80;  \n}\n"},
+			expected: "conf: |\n  server {\n  \tlisten 80;  \n  }\n",
+		},
+		{
+			name:     "no trailing newline",
+			value:    map[string]interface{}{"a": map[string]interface{}{"b": "foo\nbar"}},
+			expected: "a:\n  b: |-\n    foo\n    bar\n",
+		},
+		{
+			name:     "multiple trailing newlines",
+			value:    map[string]interface{}{"a": "foo\n\n"},
+			expected: "a: |+\n  foo\n\n",
+		},
+		{
+			name:     "leading spaces",
+			value:    map[string]interface{}{"a": "  foo\nbar"},
+			expected: "a: |2-\n    foo\n  bar\n",
+		},
+		{
+			name:     "list items",
+			value:    map[string]interface{}{"list": []interface{}{"foo\nbar", map[string]interface{}{"x": "  a\nb\n"}}},
+			expected: "list:\n- |-\n  foo\n  bar\n- x: |2\n      a\n    b\n",
+		},
+		{
+			name:     "top-level value",
+			value:    " foo\nbar\n",
+			expected: "|2\n   foo\n  bar\n",
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			encoded, err := encodeYAML(testcase.value)
+			if err != nil {
+				t.Fatalf("Failed to encode value: %v", err)
+			}
+
+			if encoded != testcase.expected {
+				t.Errorf("Expected %q, but got %q.", testcase.expected, encoded)
+			}
+
+			var decoded interface{}
+			if err := yaml.Unmarshal([]byte(encoded), &decoded); err != nil {
+				t.Fatalf("Failed to decode %q: %v", encoded, err)
+			}
+
+			if !reflect.DeepEqual(testcase.value, decoded) {
+				t.Errorf("Expected %q to decode to %q, but got %q.", encoded, testcase.value, decoded)
+			}
+		})
+	}
+}
+
+func TestRenderLineDiff(t *testing.T) {
+	oldValue := "a\nb\nc\nd\ne\nf\n"
+	newValue := "a\nb\nc\nD\ne\nf\n"
+
+	var builder strings.Builder
+	renderLineDiff(&builder, oldValue, newValue, 1, map[cdiff.Tag]color.Style{})
+
+	expected := "  @@ -3,3 +3,3 @@\n   c\n  -d\n  +D\n   e\n"
+	if builder.String() != expected {
+		t.Errorf("Expected %q, but got %q.", expected, builder.String())
+	}
+}
@@ -6,15 +6,48 @@ package diff
 import (
 	"errors"
 	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
 
 	"github.com/gookit/color"
 	"github.com/shibukawa/cdiff"
 
 	"go.xrstf.de/stalk/pkg/maputil"
 
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/util/jsonpath"
 )
 
+// KindMatcher decides whether a kind given by the user (e.g. "deploy" or
+// "pods") matches an object's kind.
+type KindMatcher interface {
+	MatchesKind(kind string, gvk schema.GroupVersionKind) bool
+}
+
+// KindOptions are options that only apply to objects of a specific kind.
+// Path rules are added to the global rules, the JSONPath and context lines
+// replace the global settings.
+type KindOptions struct {
+	Kind         string
+	ContextLines *int
+	JSONPath     string
+	IncludePaths []string
+	ExcludePaths []string
+	RedactPaths  []string
+	ExpandPaths  []string
+}
+
+const (
+	// LayoutUnified prints diffs in the unified format (like `diff -u`).
+	LayoutUnified = "unified"
+	// LayoutSideBySide prints the old and new object next to each other.
+	LayoutSideBySide = "side-by-side"
+	// LayoutFields prints one line per changed field instead of a text diff.
+	LayoutFields = "fields"
+)
+
 type Options struct {
 	ContextLines    int
 	HideEmptyDiffs  bool
@@ -23,12 +56,85 @@ type Options struct {
 	JSONPath         string
 	compiledJSONPath *jsonpath.JSONPath
 
+	// ExpandPaths are paths of strings that contain JSON or YAML, which are
+	// parsed into nested structures right after the JSONPath is applied.
+	ExpandPaths       []string
+	parsedExpandPaths []maputil.Path
+
+	// ExpandEmbedded automatically expands all strings that contain JSON
+	// objects or lists, or multi-line YAML documents.
+	ExpandEmbedded bool
+
 	IncludePaths       []string
 	parsedIncludePaths []maputil.Path
 
 	ExcludePaths       []string
 	parsedExcludePaths []maputil.Path
 
+	// RedactPaths are paths whose values are replaced with a short hash
+	// after the include and exclude paths have been applied.
+	RedactPaths       []string
+	parsedRedactPaths []maputil.Path
+
+	// RedactRegexes are regular expressions whose matches in any value are
+	// replaced with a short hash, including in the diff headers.
+	RedactRegexes         []string
+	compiledRedactRegexes []*regexp.Regexp
+
+	// TitleTemplate is an optional Go template to render the diff headers
+	// with, see TitleData for the available fields.
+	TitleTemplate         string
+	compiledTitleTemplate *template.Template
+
+	// Cluster is the name of the cluster the objects are coming from.
+	Cluster string
+
+	// Layout is one of LayoutUnified (the default), LayoutSideBySide or
+	// LayoutFields.
+	Layout string
+
+	// Width is the total width available for side-by-side diffs, usually
+	// the terminal width. Very small widths are increased to a sensible
+	// minimum.
+	Width int
+
+	// MatchListItems enables matching list items by their keys (e.g. the
+	// name of a container) instead of their position. Keys are taken from
+	// the ListKeyResolver or a list of well-known Kubernetes merge keys.
+	MatchListItems  bool
+	ListKeyResolver ListKeyResolver
+
+	// IgnoreOrder sorts all lists whose items cannot be matched by key, so
+	// that only added and removed items are shown.
+	IgnoreOrder bool
+
+	// Managers only shows changes made by these field managers (globs like
+	// "kubectl*" are supported). Managers are determined by comparing the
+	// managedFields of both versions of an object; changes whose managers
+	// cannot be determined are hidden.
+	Managers []string
+
+	// AnnotateManagers shows the managers owning each changed field.
+	AnnotateManagers bool
+
+	// DecodeSecrets base64-decodes the data of Secrets and the binaryData of
+	// ConfigMaps, as long as the values are text.
+	DecodeSecrets bool
+
+	// RedactSecrets replaces the values of Secrets with a short hash and
+	// marks whether they changed.
+	RedactSecrets bool
+
+	// MaxValueLength is the number of characters after which string values
+	// are truncated and summarized by their length and hash (0 disables
+	// truncation). Changed values are reduced to the changed region.
+	MaxValueLength int
+
+	// Kinds contains options scoped to specific kinds, which are matched
+	// against objects using the KindMatcher.
+	Kinds       []KindOptions
+	KindMatcher KindMatcher
+
 	CreateColorTheme map[cdiff.Tag]color.Style
 	UpdateColorTheme map[cdiff.Tag]color.Style
 	DeleteColorTheme map[cdiff.Tag]color.Style
@@ -39,6 +145,22 @@ func (o *Options) Validate() error {
 		return errors.New("context lines cannot be negative")
 	}
 
+	if o.MaxValueLength < 0 {
+		return errors.New("max value length cannot be negative")
+	}
+
+	switch o.Layout {
+	case "", LayoutUnified, LayoutSideBySide, LayoutFields:
+	default:
+		return fmt.Errorf("invalid layout %q, must be one of %s, %s or %s", o.Layout, LayoutUnified, LayoutSideBySide, LayoutFields)
+	}
+
+	for _, manager := range o.Managers {
+		if _, err := filepath.Match(manager, ""); err != nil {
+			return fmt.Errorf("invalid manager %q: %w", manager, err)
+		}
+	}
+
 	if o.JSONPath != "" {
 		path := jsonpath.New("mypath")
 		if err := path.Parse(o.JSONPath); err != nil {
@@ -51,6 +173,19 @@ func (o *Options) Validate() error {
 		o.compiledJSONPath = path
 	}
 
+	if len(o.ExpandPaths) > 0 {
+		o.parsedExpandPaths = []maputil.Path{}
+
+		for _, path := range o.ExpandPaths {
+			parsed, err := maputil.ParsePath(path)
+			if err != nil {
+				return fmt.Errorf("invalid expand expression %q: %w", path, err)
+			}
+
+			o.parsedExpandPaths = append(o.parsedExpandPaths, parsed)
+		}
+	}
+
 	if len(o.IncludePaths) > 0 {
 		o.parsedIncludePaths = []maputil.Path{}
 
@@ -77,5 +212,97 @@ func (o *Options) Validate() error {
 		}
 	}
 
+	if len(o.RedactPaths) > 0 {
+		o.parsedRedactPaths = []maputil.Path{}
+
+		for _, path := range o.RedactPaths {
+			parsed, err := maputil.ParsePath(path)
+			if err != nil {
+				return fmt.Errorf("invalid redact expression %q: %w", path, err)
+			}
+
+			o.parsedRedactPaths = append(o.parsedRedactPaths, parsed)
+		}
+	}
+
+	if len(o.RedactRegexes) > 0 {
+		o.compiledRedactRegexes = []*regexp.Regexp{}
+
+		for _, expr := range o.RedactRegexes {
+			compiled, err := regexp.Compile(expr)
+			if err != nil {
+				return fmt.Errorf("invalid redact pattern %q: %w", expr, err)
+			}
+
+			o.compiledRedactRegexes = append(o.compiledRedactRegexes, compiled)
+		}
+	}
+
+	for _, kind := range o.Kinds {
+		if kind.Kind == "" {
+			return errors.New("kind options must specify a kind")
+		}
+
+		if len(kind.IncludePaths) > 0 || len(kind.ExcludePaths) > 0 || len(kind.RedactPaths) > 0 || len(kind.ExpandPaths) > 0 || kind.JSONPath != "" || kind.ContextLines != nil {
+			if o.KindMatcher == nil {
+				return errors.New("kind options require a kind matcher")
+			}
+		}
+
+		if err := o.ForKind(kind).Validate(); err != nil {
+			return fmt.Errorf("invalid options for %s: %w", kind.Kind, err)
+		}
+	}
+
+	// redact paths are relative to the JSONPath result and cannot be applied
+	// to the labels and annotations shown in titles
+	if len(o.RedactPaths) > 0 && o.JSONPath != "" && titleShowsMetadata(o.TitleTemplate) {
+		return errors.New("redact paths cannot be combined with a JSON path and a title template that shows labels or annotations")
+	}
+
+	if o.TitleTemplate != "" {
+		tpl, err := parseTitleTemplate(o.TitleTemplate)
+		if err != nil {
+			return fmt.Errorf("invalid title template: %w", err)
+		}
+
+		o.compiledTitleTemplate = tpl
+	}
+
 	return nil
 }
+
+// ForKind returns a copy of the options with the given kind options applied.
+func (o *Options) ForKind(kind KindOptions) *Options {
+	result := *o
+	result.Kinds = nil
+	result.IncludePaths = append(append([]string{}, o.IncludePaths...), kind.IncludePaths...)
+	result.ExcludePaths = append(append([]string{}, o.ExcludePaths...), kind.ExcludePaths...)
+	result.RedactPaths = append(append([]string{}, o.RedactPaths...), kind.RedactPaths...)
+	result.ExpandPaths = append(append([]string{}, o.ExpandPaths...), kind.ExpandPaths...)
+
+	if kind.JSONPath != "" {
+		result.JSONPath = kind.JSONPath
+	}
+
+	if kind.ContextLines != nil {
+		result.ContextLines = *kind.ContextLines
+	}
+
+	return &result
+}
+
+// ParseKindRule splits a rule like "pods:status.conditions" into the kind
+// ("pods") and the rule itself ("status.conditions"). If the rule is not
+// scoped to a kind, the returned kind is empty.
+func ParseKindRule(rule string) (kind string, value string) {
+	kind, value, found := strings.Cut(rule, ":")
+
+	// JSONPath expressions can contain colons (e.g. in slices like [0:2]),
+	// so only a prefix before the expression itself is treated as the kind
+	if !found || kind == "" || strings.ContainsAny(kind, "{[") {
+		return "", rule
+	}
+
+	return kind, value
+}
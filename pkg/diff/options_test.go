@@ -0,0 +1,199 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package diff
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestParseKindRule(t *testing.T) {
+	testcases := []struct {
+		rule          string
+		expectedKind  string
+		expectedValue string
+	}{
+		{
+			rule:          "status.conditions",
+			expectedKind:  "",
+			expectedValue: "status.conditions",
+		},
+		{
+			rule:          "pods:status.conditions",
+			expectedKind:  "pods",
+			expectedValue: "status.conditions",
+		},
+		{
+			rule:          "deploy.apps:spec",
+			expectedKind:  "deploy.apps",
+			expectedValue: "spec",
+		},
+		{
+			rule:          ":spec",
+			expectedKind:  "",
+			expectedValue: ":spec",
+		},
+		{
+			rule:          "{.spec.containers[0:2]}",
+			expectedKind:  "",
+			expectedValue: "{.spec.containers[0:2]}",
+		},
+		{
+			rule:          "pods:{.spec.containers[0:2]}",
+			expectedKind:  "pods",
+			expectedValue: "{.spec.containers[0:2]}",
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.rule, func(t *testing.T) {
+			kind, value := ParseKindRule(testcase.rule)
+			if kind != testcase.expectedKind || value != testcase.expectedValue {
+				t.Errorf("Expected (%q, %q), but got (%q, %q).", testcase.expectedKind, testcase.expectedValue, kind, value)
+			}
+		})
+	}
+}
+
+func TestForKind(t *testing.T) {
+	contextLines := 10
+
+	testcases := []struct {
+		name     string
+		base     Options
+		kind     KindOptions
+		expected Options
+	}{
+		{
+			name:     "empty kind options change nothing",
+			base:     Options{ContextLines: 3, JSONPath: "{.spec}", ExcludePaths: []string{"status"}},
+			kind:     KindOptions{Kind: "pods"},
+			expected: Options{ContextLines: 3, JSONPath: "{.spec}", ExcludePaths: []string{"status"}, IncludePaths: []string{}, RedactPaths: []string{}, ExpandPaths: []string{}},
+		},
+		{
+			name: "paths are added to the global paths",
+			base: Options{IncludePaths: []string{"spec"}, ExcludePaths: []string{"status"}, RedactPaths: []string{"data"}, ExpandPaths: []string{"a"}},
+			kind: KindOptions{Kind: "pods", IncludePaths: []string{"metadata"}, ExcludePaths: []string{"spec.x"}, RedactPaths: []string{"stringData"}, ExpandPaths: []string{"b"}},
+			expected: Options{
+				IncludePaths: []string{"spec", "metadata"},
+				ExcludePaths: []string{"status", "spec.x"},
+				RedactPaths:  []string{"data", "stringData"},
+				ExpandPaths:  []string{"a", "b"},
+			},
+		},
+		{
+			name:     "JSONPath and context lines replace the global settings",
+			base:     Options{ContextLines: 3, JSONPath: "{.spec}"},
+			kind:     KindOptions{Kind: "pods", JSONPath: "{.status}", ContextLines: &contextLines},
+			expected: Options{ContextLines: 10, JSONPath: "{.status}", IncludePaths: []string{}, ExcludePaths: []string{}, RedactPaths: []string{}, ExpandPaths: []string{}},
+		},
+		{
+			name:     "kind options are not inherited",
+			base:     Options{Kinds: []KindOptions{{Kind: "pods"}}},
+			kind:     KindOptions{Kind: "pods"},
+			expected: Options{IncludePaths: []string{}, ExcludePaths: []string{}, RedactPaths: []string{}, ExpandPaths: []string{}},
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			base := testcase.base
+			before := base
+
+			result := base.ForKind(testcase.kind)
+			if !reflect.DeepEqual(testcase.expected, *result) {
+				t.Errorf("Expected %+v, but got %+v.", testcase.expected, *result)
+			}
+
+			if !reflect.DeepEqual(before, base) {
+				t.Errorf("Expected the global options to be unchanged, but got %+v.", base)
+			}
+		})
+	}
+}
+
+// lowercaseKindMatcher matches kinds like "deployment" case-insensitively.
+type lowercaseKindMatcher struct{}
+
+func (lowercaseKindMatcher) MatchesKind(kind string, gvk schema.GroupVersionKind) bool {
+	return strings.EqualFold(kind, gvk.Kind)
+}
+
+func TestOptionsFor(t *testing.T) {
+	contextLines := 10
+
+	testcases := []struct {
+		name                 string
+		kinds                []KindOptions
+		gvk                  schema.GroupVersionKind
+		expectedExcludePaths []string
+		expectedContextLines int
+	}{
+		{
+			name:                 "no kind options",
+			gvk:                  schema.GroupVersionKind{Version: "v1", Kind: "Pod"},
+			expectedExcludePaths: []string{"status"},
+			expectedContextLines: 3,
+		},
+		{
+			name:                 "other kinds are ignored",
+			kinds:                []KindOptions{{Kind: "deployment", ExcludePaths: []string{"spec"}}},
+			gvk:                  schema.GroupVersionKind{Version: "v1", Kind: "Pod"},
+			expectedExcludePaths: []string{"status"},
+			expectedContextLines: 3,
+		},
+		{
+			name:                 "matching kind",
+			kinds:                []KindOptions{{Kind: "pod", ExcludePaths: []string{"spec"}, ContextLines: &contextLines}},
+			gvk:                  schema.GroupVersionKind{Version: "v1", Kind: "Pod"},
+			expectedExcludePaths: []string{"status", "spec"},
+			expectedContextLines: 10,
+		},
+		{
+			name: "all matching kind options are merged",
+			kinds: []KindOptions{
+				{Kind: "pod", ExcludePaths: []string{"spec"}},
+				{Kind: "deployment", ExcludePaths: []string{"metadata"}},
+				{Kind: "POD", ExcludePaths: []string{"metadata.labels"}},
+			},
+			gvk:                  schema.GroupVersionKind{Version: "v1", Kind: "Pod"},
+			expectedExcludePaths: []string{"status", "spec", "metadata.labels"},
+			expectedContextLines: 3,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			differ, err := NewDiffer(&Options{
+				ContextLines: 3,
+				ExcludePaths: []string{"status"},
+				Kinds:        testcase.kinds,
+				KindMatcher:  lowercaseKindMatcher{},
+			}, logrus.New())
+			if err != nil {
+				t.Fatalf("Failed to create differ: %v", err)
+			}
+
+			opt := differ.optionsFor(testcase.gvk)
+
+			if !reflect.DeepEqual(testcase.expectedExcludePaths, opt.ExcludePaths) {
+				t.Errorf("Expected exclude paths %v, but got %v.", testcase.expectedExcludePaths, opt.ExcludePaths)
+			}
+
+			if opt.ContextLines != testcase.expectedContextLines {
+				t.Errorf("Expected %d context lines, but got %d.", testcase.expectedContextLines, opt.ContextLines)
+			}
+
+			// the result is cached per kind
+			if cached := differ.optionsFor(testcase.gvk); cached != opt {
+				t.Error("Expected the options to be cached.")
+			}
+		})
+	}
+}
@@ -9,15 +9,25 @@ import (
 	"github.com/sirupsen/logrus"
 
 	"go.xrstf.de/stalk/pkg/cache"
+	"go.xrstf.de/stalk/pkg/metrics"
 
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/watch"
 )
 
+// Observer is notified about every object the Printer handles, regardless of
+// whether a diff was printed for it or not.
+type Observer interface {
+	Observe(obj *unstructured.Unstructured, event watch.EventType)
+}
+
 type Printer struct {
-	differ *Differ
-	log    logrus.FieldLogger
-	cache  *cache.ResourceCache
+	differ    *Differ
+	log       logrus.FieldLogger
+	cache     *cache.ResourceCache
+	observers []Observer
+	sinks     []Sink
+	desired   *DesiredState
 }
 
 func NewPrinter(differ *Differ, log logrus.FieldLogger) *Printer {
@@ -28,25 +38,118 @@ func NewPrinter(differ *Differ, log logrus.FieldLogger) *Printer {
 	}
 }
 
+func (p *Printer) AddObserver(o Observer) {
+	p.observers = append(p.observers, o)
+}
+
+func (p *Printer) AddSink(s Sink) {
+	p.sinks = append(p.sinks, s)
+}
+
+// SetDesiredState makes the Printer compare every live object against its
+// desired state instead of its previously seen version. Objects without a
+// desired state are ignored.
+func (p *Printer) SetDesiredState(desired *DesiredState) {
+	p.desired = desired
+}
+
+// Close waits for all sinks to finish handling their events.
+func (p *Printer) Close() {
+	for _, s := range p.sinks {
+		s.Close()
+	}
+}
+
 func (p *Printer) Print(obj *unstructured.Unstructured, event watch.EventType) {
-	switch event {
-	case watch.Added:
-		if err := p.differ.PrintDiff(nil, obj, time.Time{}); err != nil {
-			p.log.Errorf("Failed to show diff: %w", err)
-		}
-		p.cache.Set(obj)
-
-	case watch.Modified:
+	p.PrintChange(obj, event, nil)
+}
+
+// PrintChange is like Print, but also shows who made the change.
+func (p *Printer) PrintChange(obj *unstructured.Unstructured, event watch.EventType, actor *Actor) {
+	seen := time.Now()
+	if actor != nil && !actor.Timestamp.IsZero() {
+		seen = actor.Timestamp
+	}
+
+	switch {
+	case p.desired != nil:
+		p.printDrift(event, obj)
+
+	case event == watch.Added:
+		p.printDiff(event, nil, obj, time.Time{}, actor)
+		p.cache.SetSeen(obj, seen)
+
+	case event == watch.Modified:
 		previous, lastSeen := p.cache.Get(obj)
-		if err := p.differ.PrintDiff(previous, obj, lastSeen); err != nil {
-			p.log.Errorf("Failed to show diff: %w", err)
-		}
-		p.cache.Set(obj)
-
-	case watch.Deleted:
-		if err := p.differ.PrintDiff(obj, nil, time.Now()); err != nil {
-			p.log.Errorf("Failed to show diff: %w", err)
-		}
+		p.printDiff(event, previous, obj, lastSeen, actor)
+		p.cache.SetSeen(obj, seen)
+
+	case event == watch.Deleted:
+		p.printDiff(event, obj, nil, seen, actor)
 		p.cache.Delete(obj)
 	}
+
+	metrics.CacheSize.Set(float64(p.cache.Len()))
+
+	p.observe(obj, event)
+}
+
+// observe counts the event and notifies all observers. This is also used for
+// events that are not printed by the Printer itself, like in a Comparison.
+func (p *Printer) observe(obj *unstructured.Unstructured, event watch.EventType) {
+	metrics.EventsReceived.WithLabelValues(append(metrics.GVK(obj.GroupVersionKind()), string(event))...).Inc()
+
+	for _, o := range p.observers {
+		o.Observe(obj, event)
+	}
+}
+
+func (p *Printer) printDiff(eventType watch.EventType, oldObj, newObj *unstructured.Unstructured, lastSeen time.Time, actor *Actor) {
+	event, err := p.differ.PrintChange(oldObj, newObj, lastSeen, actor)
+	if err != nil {
+		p.log.Errorf("Failed to show diff: %v", err)
+		return
+	}
+
+	if event == nil {
+		return
+	}
+
+	p.send(eventType, event)
+}
+
+func (p *Printer) printDrift(eventType watch.EventType, obj *unstructured.Unstructured) {
+	desired, exists := p.desired.get(obj)
+	if !exists {
+		return
+	}
+
+	live := obj
+	if eventType == watch.Deleted {
+		live = nil
+	}
+
+	event, drift, err := p.differ.PrintDrift(desired.object, live, desired.source)
+	if err != nil {
+		p.log.Errorf("Failed to show drift: %v", err)
+		return
+	}
+
+	p.differ.printDriftSummary(obj, drift, p.desired.updateDrift(obj, drift))
+
+	if event != nil {
+		p.send(eventType, event)
+	}
+}
+
+func (p *Printer) send(eventType watch.EventType, event *Event) {
+	event.Type = eventType
+
+	if len(p.sinks) > 0 {
+		event.resolveDiff()
+	}
+
+	for _, s := range p.sinks {
+		s.Send(event)
+	}
 }
@@ -0,0 +1,147 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package diff
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sirupsen/logrus"
+
+	"go.xrstf.de/stalk/pkg/metrics"
+
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+func TestPrinterMetrics(t *testing.T) {
+	type printerEvent struct {
+		event watch.EventType
+		obj   string
+	}
+
+	testcases := []struct {
+		name       string
+		events     []printerEvent
+		received   map[watch.EventType]float64
+		printed    float64
+		suppressed float64
+		cacheSize  float64
+	}{
+		{
+			name: "every event is counted and printed",
+			events: []printerEvent{
+				{event: watch.Added, obj: `{metadata: {name: a}, spec: {x: 1}}`},
+				{event: watch.Modified, obj: `{metadata: {name: a}, spec: {x: 2}}`},
+				{event: watch.Deleted, obj: `{metadata: {name: a}, spec: {x: 2}}`},
+			},
+			received:  map[watch.EventType]float64{watch.Added: 1, watch.Modified: 1, watch.Deleted: 1},
+			printed:   3,
+			cacheSize: 0,
+		},
+		{
+			name: "empty diffs are suppressed",
+			events: []printerEvent{
+				{event: watch.Added, obj: `{metadata: {name: a}, spec: {x: 1}}`},
+				{event: watch.Added, obj: `{metadata: {name: b}, spec: {x: 1}}`},
+				{event: watch.Modified, obj: `{metadata: {name: a}, spec: {x: 1}, status: {ready: true}}`},
+			},
+			received:   map[watch.EventType]float64{watch.Added: 2, watch.Modified: 1},
+			printed:    2,
+			suppressed: 1,
+			cacheSize:  2,
+		},
+	}
+
+	for i, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			differ, err := NewDiffer(&Options{
+				HideEmptyDiffs: true,
+				ExcludePaths:   []string{"status"},
+			}, logrus.New())
+			if err != nil {
+				t.Fatalf("Failed to create differ: %v", err)
+			}
+
+			printer := NewPrinter(differ, logrus.New())
+
+			// metrics are global, so every testcase uses its own kind and
+			// only the changes are compared
+			kind := fmt.Sprintf("Test%d", i)
+			labels := []string{"example.com", "v1", kind}
+
+			counters := map[string]prometheus.Counter{
+				"printed":    metrics.DiffsPrinted.WithLabelValues(labels...),
+				"suppressed": metrics.DiffsSuppressed.WithLabelValues(labels...),
+			}
+
+			for _, eventType := range []watch.EventType{watch.Added, watch.Modified, watch.Deleted} {
+				counters["received "+string(eventType)] = metrics.EventsReceived.WithLabelValues(append(labels, string(eventType))...)
+			}
+
+			before := map[string]float64{}
+			for name, counter := range counters {
+				before[name] = testutil.ToFloat64(counter)
+			}
+
+			for _, event := range testcase.events {
+				obj := parseObject(t, event.obj)
+				obj.SetAPIVersion("example.com/v1")
+				obj.SetKind(kind)
+
+				printer.Print(obj, event.event)
+			}
+
+			expected := map[string]float64{
+				"printed":    testcase.printed,
+				"suppressed": testcase.suppressed,
+			}
+
+			for eventType, received := range testcase.received {
+				expected["received "+string(eventType)] = received
+			}
+
+			for name, counter := range counters {
+				if value := testutil.ToFloat64(counter) - before[name]; value != expected[name] {
+					t.Errorf("Expected %v %s, but got %v.", expected[name], name, value)
+				}
+			}
+
+			if cacheSize := testutil.ToFloat64(metrics.CacheSize); cacheSize != testcase.cacheSize {
+				t.Errorf("Expected %v cached objects, but got %v.", testcase.cacheSize, cacheSize)
+			}
+		})
+	}
+}
+
+func TestPrinterEventDiff(t *testing.T) {
+	for _, layout := range []string{LayoutUnified, LayoutSideBySide, LayoutFields} {
+		t.Run(layout, func(t *testing.T) {
+			differ, err := NewDiffer(&Options{Layout: layout}, logrus.New())
+			if err != nil {
+				t.Fatalf("Failed to create differ: %v", err)
+			}
+
+			sink := &recordingSink{}
+
+			printer := NewPrinter(differ, logrus.New())
+			printer.AddSink(sink)
+
+			printer.Print(parseObject(t, `{apiVersion: v1, kind: ConfigMap, metadata: {name: a}, data: {x: foo}}`), watch.Added)
+			printer.Print(parseObject(t, `{apiVersion: v1, kind: ConfigMap, metadata: {name: a}, data: {x: bar}}`), watch.Modified)
+
+			if len(sink.events) != 2 {
+				t.Fatalf("Expected 2 events, but got %d.", len(sink.events))
+			}
+
+			// sinks always receive the unified diff, regardless of the layout
+			diff := sink.events[1].Diff
+			if !strings.Contains(diff, "-  x: foo") || !strings.Contains(diff, "+  x: bar") {
+				t.Errorf("Expected a unified diff, but got %q.", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package diff
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+
+	"go.xrstf.de/stalk/pkg/maputil"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// redactionKey is used to hash redacted values. It is random for every run,
+// so that hashes cannot be used to guess short values like passwords, but
+// are stable for the lifetime of the process.
+var redactionKey = func() []byte {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(fmt.Sprintf("failed to generate redaction key: %v", err))
+	}
+
+	return key
+}()
+
+// redactedValue returns a short hash of the value.
+func redactedValue(value string) string {
+	mac := hmac.New(sha256.New, redactionKey)
+	mac.Write([]byte(value))
+
+	return "redacted:" + hex.EncodeToString(mac.Sum(nil))[:12]
+}
+
+// redactAll replaces all scalar values in the value with their hash. Maps
+// and lists keep their structure, so that it is still visible which part of
+// a redacted value changed.
+func redactAll(value interface{}) interface{} {
+	switch asserted := value.(type) {
+	case map[string]interface{}:
+		for key, child := range asserted {
+			asserted[key] = redactAll(child)
+		}
+
+		return asserted
+
+	case []interface{}:
+		for i, item := range asserted {
+			asserted[i] = redactAll(item)
+		}
+
+		return asserted
+
+	case nil:
+		return nil
+	}
+
+	return redactedValue(fmt.Sprint(value))
+}
+
+// redactMatches replaces every match of the regular expressions in all
+// values (including map keys) with the hash of the match.
+func redactMatches(value interface{}, regexes []*regexp.Regexp) interface{} {
+	if len(regexes) == 0 {
+		return value
+	}
+
+	switch asserted := value.(type) {
+	case map[string]interface{}:
+		// collect the keys first, as redacted keys must not be visited again
+		keys := make([]string, 0, len(asserted))
+		for key := range asserted {
+			keys = append(keys, key)
+		}
+
+		for _, key := range keys {
+			child := asserted[key]
+
+			redactedKey := redactString(key, regexes)
+			if redactedKey != key {
+				delete(asserted, key)
+			}
+
+			asserted[redactedKey] = redactMatches(child, regexes)
+		}
+
+		return asserted
+
+	case []interface{}:
+		for i, item := range asserted {
+			asserted[i] = redactMatches(item, regexes)
+		}
+
+		return asserted
+
+	case string:
+		return redactString(asserted, regexes)
+
+	case nil:
+		return nil
+	}
+
+	// numbers and booleans are only turned into strings if they match
+	if formatted := fmt.Sprint(value); redactString(formatted, regexes) != formatted {
+		return redactString(formatted, regexes)
+	}
+
+	return value
+}
+
+func redactString(value string, regexes []*regexp.Regexp) string {
+	for _, regex := range regexes {
+		value = regex.ReplaceAllStringFunc(value, redactedValue)
+	}
+
+	return value
+}
+
+// redactObject returns a copy of the object with all redact paths applied,
+// so that its metadata can be shown in titles and events. Redact paths are
+// relative to the JSONPath result, so they cannot be applied to the object
+// if a JSONPath is configured (Options.Validate prevents title templates
+// from showing labels and annotations in this case).
+func (d *Differ) redactObject(obj *unstructured.Unstructured) *unstructured.Unstructured {
+	if obj == nil {
+		return nil
+	}
+
+	opt := d.optionsFor(obj.GroupVersionKind())
+	if len(opt.parsedRedactPaths) == 0 || opt.compiledJSONPath != nil {
+		return obj
+	}
+
+	obj = obj.DeepCopy()
+	for _, path := range opt.parsedRedactPaths {
+		obj.Object = maputil.TransformPath(obj.Object, path, redactAll).(map[string]interface{})
+	}
+
+	return obj
+}
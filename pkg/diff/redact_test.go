@@ -0,0 +1,175 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package diff
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// hashPlaceholder matches placeholders like "<secret>" in the expected test
+// results, which are replaced with the hash of the enclosed value.
+var hashPlaceholder = regexp.MustCompile(`<([^>]*)>`)
+
+func TestRedact(t *testing.T) {
+	testcases := []struct {
+		name     string
+		opt      Options
+		obj      string
+		expected string
+	}{
+		{
+			name:     "values at paths are hashed",
+			opt:      Options{RedactPaths: []string{"spec.token"}},
+			obj:      `{spec: {token: secret, replicas: 3}}`,
+			expected: `{spec: {token: "<secret>", replicas: 3}}`,
+		},
+		{
+			name:     "nested values keep their structure",
+			opt:      Options{RedactPaths: []string{"spec"}},
+			obj:      `{spec: {token: secret, replicas: 3, list: [a, b]}}`,
+			expected: `{spec: {token: "<secret>", replicas: "<3>", list: ["<a>", "<b>"]}}`,
+		},
+		{
+			name:     "paths match all list items",
+			opt:      Options{RedactPaths: []string{"spec.containers.env.value"}},
+			obj:      `{spec: {containers: [{name: app, env: [{name: PASSWORD, value: secret}, {name: USER}]}]}}`,
+			expected: `{spec: {containers: [{name: app, env: [{name: PASSWORD, value: "<secret>"}, {name: USER}]}]}}`,
+		},
+		{
+			name:     "paths are applied after hiding",
+			opt:      Options{ExcludePaths: []string{"spec.token"}, RedactPaths: []string{"spec"}},
+			obj:      `{spec: {token: secret, replicas: 3}}`,
+			expected: `{spec: {replicas: "<3>"}}`,
+		},
+		{
+			name:     "regexes replace only the matches",
+			opt:      Options{RedactRegexes: []string{`sk-[a-z0-9]+`}},
+			obj:      `{spec: {args: ["--key=sk-abc123", "--verbose"]}}`,
+			expected: `{spec: {args: ["--key=<sk-abc123>", "--verbose"]}}`,
+		},
+		{
+			name:     "regexes apply to keys and numbers",
+			opt:      Options{RedactRegexes: []string{`4111[0-9]+`}},
+			obj:      `{data: {card-4111222233334444: valid, number: 4111222233334444}}`,
+			expected: `{data: {card-<4111222233334444>: valid, number: "<4111222233334444>"}}`,
+		},
+		{
+			name:     "regexes apply to scalar JSONPath results",
+			opt:      Options{JSONPath: "{.spec.token}", RedactRegexes: []string{`sec.*`}},
+			obj:      `{spec: {token: secret}}`,
+			expected: `"<secret>"`,
+		},
+		{
+			name:     "paths apply to list JSONPath results",
+			opt:      Options{JSONPath: "{.spec.containers}", RedactPaths: []string{"env.value"}},
+			obj:      `{spec: {containers: [{name: app, env: [{name: PASSWORD, value: secret}]}]}}`,
+			expected: `[{name: app, env: [{name: PASSWORD, value: "<secret>"}]}]`,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			differ, err := NewDiffer(&testcase.opt, logrus.New())
+			if err != nil {
+				t.Fatalf("Failed to create differ: %v", err)
+			}
+
+			obj := parseObject(t, testcase.obj)
+
+			result, err := differ.preprocess(obj, differ.optionsFor(obj.GroupVersionKind()))
+			if err != nil {
+				t.Fatalf("Failed to preprocess object: %v", err)
+			}
+
+			expected := parseYAML(t, hashPlaceholder.ReplaceAllStringFunc(testcase.expected, func(match string) string {
+				return redactedValue(strings.Trim(match, "<>"))
+			}))
+
+			// compare the encoded values, as YAML and JSON decode numbers differently
+			expectedEncoded, _ := json.Marshal(expected)
+			resultEncoded, _ := json.Marshal(result)
+
+			if string(expectedEncoded) != string(resultEncoded) {
+				t.Errorf("Expected %s, but got %s.", expectedEncoded, resultEncoded)
+			}
+		})
+	}
+}
+
+func TestRedactTitles(t *testing.T) {
+	differ, err := NewDiffer(&Options{RedactRegexes: []string{`secret-[a-z]+`}}, logrus.New())
+	if err != nil {
+		t.Fatalf("Failed to create differ: %v", err)
+	}
+
+	oldObj := parseObject(t, `{apiVersion: v1, kind: ConfigMap, metadata: {name: secret-name}, data: {foo: bar}}`)
+	newObj := parseObject(t, `{apiVersion: v1, kind: ConfigMap, metadata: {name: secret-name}, data: {foo: baz}}`)
+
+	event, err := differ.printDiff(oldObj, newObj, "old secret-name", "new secret-name")
+	if err != nil {
+		t.Fatalf("Failed to print diff: %v", err)
+	}
+
+	if strings.Contains(event.Diff, "secret-name") || strings.Contains(event.Name, "secret-name") {
+		t.Errorf("Expected the name to be redacted, but got %q.", event.Diff)
+	}
+}
+
+func TestRedactDescribeObject(t *testing.T) {
+	differ, err := NewDiffer(&Options{RedactRegexes: []string{`secret-[a-z]+`}}, logrus.New())
+	if err != nil {
+		t.Fatalf("Failed to create differ: %v", err)
+	}
+
+	obj := parseObject(t, `{apiVersion: v1, kind: ConfigMap, metadata: {name: secret-name, namespace: default}}`)
+
+	if description := differ.DescribeObject(obj); strings.Contains(description, "secret-name") || !strings.HasPrefix(description, "ConfigMap default/") {
+		t.Errorf("Expected the name to be redacted, but got %q.", description)
+	}
+}
+
+func TestRedactTitleTemplates(t *testing.T) {
+	differ, err := NewDiffer(&Options{
+		RedactPaths:   []string{"metadata.annotations.token", "metadata.labels"},
+		TitleTemplate: "{{ .Name }} {{ .Annotations }} {{ .Labels }}",
+	}, logrus.New())
+	if err != nil {
+		t.Fatalf("Failed to create differ: %v", err)
+	}
+
+	obj := parseObject(t, `{apiVersion: v1, kind: ConfigMap, metadata: {name: foo, annotations: {token: s3cr3t, other: visible}, labels: {team: hidden}}}`)
+
+	title := differ.diffTitle(obj, time.Now(), time.Time{}, nil, nil, "")
+
+	for _, value := range []string{"s3cr3t", "hidden"} {
+		if strings.Contains(title, value) {
+			t.Errorf("Expected %q to not contain %q.", title, value)
+		}
+	}
+
+	if !strings.Contains(title, "visible") || !strings.Contains(title, redactedValue("s3cr3t")) {
+		t.Errorf("Expected %q to contain the other annotation and the hash.", title)
+	}
+
+	// the original object must not be modified
+	if obj.GetAnnotations()["token"] != "s3cr3t" {
+		t.Error("Expected the original object to not be modified.")
+	}
+
+	// paths relative to a JSONPath cannot be applied to titles
+	_, err = NewDiffer(&Options{
+		JSONPath:      "{.spec}",
+		RedactPaths:   []string{"token"},
+		TitleTemplate: "{{ .Labels }}",
+	}, logrus.New())
+	if err == nil {
+		t.Error("Expected redact paths with a JSON path and labels in the title to be rejected.")
+	}
+}
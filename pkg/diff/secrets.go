@@ -0,0 +1,168 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package diff
+
+import (
+	"encoding/base64"
+	"fmt"
+	"unicode/utf8"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const lastAppliedAnnotation = "kubectl.kubernetes.io/last-applied-configuration"
+
+// prepareSecrets decodes and/or redacts the values of Secrets and ConfigMaps,
+// depending on the options. This happens before any other processing, so
+// that the values can be used in path expressions, but never leak into the
+// output. The given objects are not modified.
+func (d *Differ) prepareSecrets(oldObj, newObj *unstructured.Unstructured) (*unstructured.Unstructured, *unstructured.Unstructured) {
+	obj := eventObject(oldObj, newObj)
+	if obj == nil {
+		return oldObj, newObj
+	}
+
+	opt := d.optionsFor(obj.GroupVersionKind())
+	if !opt.DecodeSecrets && !opt.RedactSecrets {
+		return oldObj, newObj
+	}
+
+	gvk := obj.GroupVersionKind()
+	if gvk.Group != "" || (gvk.Kind != "Secret" && gvk.Kind != "ConfigMap") {
+		return oldObj, newObj
+	}
+
+	oldObj = copyObject(oldObj)
+	newObj = copyObject(newObj)
+
+	if opt.DecodeSecrets {
+		for _, obj := range []*unstructured.Unstructured{oldObj, newObj} {
+			if obj == nil {
+				continue
+			}
+
+			if gvk.Kind == "Secret" {
+				decodeValues(obj, "data")
+			} else {
+				decodeValues(obj, "binaryData")
+			}
+		}
+	}
+
+	if opt.RedactSecrets && gvk.Kind == "Secret" {
+		redactSecret(oldObj, newObj)
+	}
+
+	return oldObj, newObj
+}
+
+func copyObject(obj *unstructured.Unstructured) *unstructured.Unstructured {
+	if obj == nil {
+		return nil
+	}
+
+	return obj.DeepCopy()
+}
+
+// decodeValues base64-decodes all values in the given field (e.g. "data")
+// that contain text. Binary values are kept as they are.
+func decodeValues(obj *unstructured.Unstructured, field string) {
+	values, ok := obj.Object[field].(map[string]interface{})
+	if !ok {
+		return
+	}
+
+	for key, value := range values {
+		encoded, ok := value.(string)
+		if !ok {
+			continue
+		}
+
+		decoded, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || !utf8.Valid(decoded) {
+			continue
+		}
+
+		values[key] = string(decoded)
+	}
+}
+
+// redactSecret replaces all values of both Secrets (either can be nil) with
+// a hash and marks whether each value changed between both versions. The
+// last-applied-configuration contains all values as well and is redacted as
+// a whole.
+func redactSecret(oldObj, newObj *unstructured.Unstructured) {
+	for _, field := range []string{"data", "stringData"} {
+		var oldValues, newValues map[string]interface{}
+
+		if oldObj != nil {
+			oldValues, _ = oldObj.Object[field].(map[string]interface{})
+		}
+
+		if newObj != nil {
+			newValues, _ = newObj.Object[field].(map[string]interface{})
+		}
+
+		redactValues(oldValues, newValues)
+	}
+
+	var oldAnnotations, newAnnotations map[string]interface{}
+
+	if oldObj != nil {
+		oldAnnotations, _, _ = unstructured.NestedMap(oldObj.Object, "metadata", "annotations")
+	}
+
+	if newObj != nil {
+		newAnnotations, _, _ = unstructured.NestedMap(newObj.Object, "metadata", "annotations")
+	}
+
+	redactKey(oldAnnotations, newAnnotations, lastAppliedAnnotation)
+
+	if oldAnnotations != nil {
+		_ = unstructured.SetNestedMap(oldObj.Object, oldAnnotations, "metadata", "annotations")
+	}
+
+	if newAnnotations != nil {
+		_ = unstructured.SetNestedMap(newObj.Object, newAnnotations, "metadata", "annotations")
+	}
+}
+
+func redactValues(oldValues, newValues map[string]interface{}) {
+	keys := map[string]struct{}{}
+	for key := range oldValues {
+		keys[key] = struct{}{}
+	}
+	for key := range newValues {
+		keys[key] = struct{}{}
+	}
+
+	for key := range keys {
+		redactKey(oldValues, newValues, key)
+	}
+}
+
+// redactKey redacts the value of the key in both maps (either can be nil).
+// If the key exists in both maps, the redacted values are marked as changed
+// or unchanged.
+func redactKey(oldValues, newValues map[string]interface{}, key string) {
+	oldValue, oldExists := oldValues[key]
+	newValue, newExists := newValues[key]
+
+	marker := ""
+	if oldExists && newExists {
+		if fmt.Sprint(oldValue) == fmt.Sprint(newValue) {
+			marker = " (unchanged)"
+		} else {
+			marker = " (changed)"
+		}
+	}
+
+	if oldExists {
+		oldValues[key] = redactedValue(fmt.Sprint(oldValue)) + marker
+	}
+
+	if newExists {
+		newValues[key] = redactedValue(fmt.Sprint(newValue)) + marker
+	}
+}
@@ -0,0 +1,128 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package diff
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func parseObject(t *testing.T, data string) *unstructured.Unstructured {
+	if data == "" {
+		return nil
+	}
+
+	return &unstructured.Unstructured{Object: parseYAML(t, data).(map[string]interface{})}
+}
+
+func TestDecodeSecrets(t *testing.T) {
+	testcases := []struct {
+		name     string
+		obj      string
+		expected string
+	}{
+		{
+			name:     "text values in Secrets are decoded",
+			obj:      `{apiVersion: v1, kind: Secret, data: {user: YWRtaW4=}}`,
+			expected: `{apiVersion: v1, kind: Secret, data: {user: admin}}`,
+		},
+		{
+			name:     "binary values are kept",
+			obj:      `{apiVersion: v1, kind: Secret, data: {key: /w==}}`,
+			expected: `{apiVersion: v1, kind: Secret, data: {key: /w==}}`,
+		},
+		{
+			name:     "invalid base64 is kept",
+			obj:      `{apiVersion: v1, kind: Secret, data: {key: "not base64"}}`,
+			expected: `{apiVersion: v1, kind: Secret, data: {key: "not base64"}}`,
+		},
+		{
+			name:     "binaryData in ConfigMaps is decoded",
+			obj:      `{apiVersion: v1, kind: ConfigMap, data: {plain: YWRtaW4=}, binaryData: {text: YWRtaW4=}}`,
+			expected: `{apiVersion: v1, kind: ConfigMap, data: {plain: YWRtaW4=}, binaryData: {text: admin}}`,
+		},
+		{
+			name:     "other kinds are not touched",
+			obj:      `{apiVersion: example.com/v1, kind: Secret, data: {user: YWRtaW4=}}`,
+			expected: `{apiVersion: example.com/v1, kind: Secret, data: {user: YWRtaW4=}}`,
+		},
+	}
+
+	differ, err := NewDiffer(&Options{DecodeSecrets: true}, logrus.New())
+	if err != nil {
+		t.Fatalf("Failed to create differ: %v", err)
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			obj := parseObject(t, testcase.obj)
+			_, decoded := differ.prepareSecrets(nil, obj)
+
+			expected := parseObject(t, testcase.expected)
+			if !reflect.DeepEqual(expected, decoded) {
+				t.Errorf("Expected %v, but got %v.", expected, decoded)
+			}
+
+			if !reflect.DeepEqual(parseObject(t, testcase.obj), obj) {
+				t.Error("Expected the original object to not be modified.")
+			}
+		})
+	}
+}
+
+func TestRedactSecrets(t *testing.T) {
+	differ, err := NewDiffer(&Options{DecodeSecrets: true, RedactSecrets: true}, logrus.New())
+	if err != nil {
+		t.Fatalf("Failed to create differ: %v", err)
+	}
+
+	oldObj := parseObject(t, `{apiVersion: v1, kind: Secret, metadata: {annotations: {kubectl.kubernetes.io/last-applied-configuration: "{}", other: visible}}, data: {user: YWRtaW4=, password: aHVudGVyMg==, removed: YQ==}}`)
+	newObj := parseObject(t, `{apiVersion: v1, kind: Secret, metadata: {annotations: {kubectl.kubernetes.io/last-applied-configuration: "{}", other: visible}}, data: {user: YWRtaW4=, password: aHVudGVyMw==}, stringData: {added: hunter4}}`)
+
+	oldRedacted, newRedacted := differ.prepareSecrets(oldObj, newObj)
+
+	expected := map[string]string{
+		"data.user":        " (unchanged)",
+		"data.password":    " (changed)",
+		"data.removed":     "",
+		"stringData.added": "",
+	}
+
+	for path, marker := range expected {
+		for _, obj := range []*unstructured.Unstructured{oldRedacted, newRedacted} {
+			value, found, _ := unstructured.NestedString(obj.Object, strings.Split(path, ".")...)
+			if !found {
+				continue
+			}
+
+			if !strings.HasPrefix(value, "redacted:") || !strings.HasSuffix(value, marker) {
+				t.Errorf("Expected %s to be redacted with marker %q, but got %q.", path, marker, value)
+			}
+
+			if strings.Contains(value, "hunter") || strings.Contains(value, "admin") {
+				t.Errorf("Expected %s to not contain the secret value, but got %q.", path, value)
+			}
+		}
+	}
+
+	oldUser, _, _ := unstructured.NestedString(oldRedacted.Object, "data", "user")
+	newUser, _, _ := unstructured.NestedString(newRedacted.Object, "data", "user")
+	if oldUser != newUser {
+		t.Errorf("Expected unchanged values to have the same hash, but got %q and %q.", oldUser, newUser)
+	}
+
+	annotations := newRedacted.GetAnnotations()
+	if !strings.HasPrefix(annotations[lastAppliedAnnotation], "redacted:") {
+		t.Errorf("Expected the last applied configuration to be redacted, but got %q.", annotations[lastAppliedAnnotation])
+	}
+
+	if annotations["other"] != "visible" {
+		t.Errorf("Expected other annotations to be kept, but got %q.", annotations["other"])
+	}
+}
@@ -0,0 +1,310 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package diff
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gookit/color"
+	"github.com/mattn/go-runewidth"
+	"github.com/shibukawa/cdiff"
+	"golang.org/x/term"
+)
+
+const (
+	sideBySideSeparator = " │ "
+	minSideBySideWidth  = 40
+	defaultWidth        = 160
+	tabWidth            = 8
+)
+
+// TerminalWidth returns the width of the terminal connected to the given
+// file. If it is not a terminal, $COLUMNS is used and if that is not set
+// either, a default width is returned.
+func TerminalWidth(file *os.File) int {
+	if width, _, err := term.GetSize(int(file.Fd())); err == nil && width > 0 {
+		return width
+	}
+
+	if width, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && width > 0 {
+		return width
+	}
+
+	return defaultWidth
+}
+
+// segment is a piece of text in a single style.
+type segment struct {
+	text  []rune
+	style color.Style
+}
+
+// renderSideBySide renders the diff as two columns, the old object on the
+// left and the new one on the right. Lines that do not fit into a column are
+// wrapped.
+func renderSideBySide(result cdiff.Result, titleA, titleB string, contextLines int, width int, theme map[cdiff.Tag]color.Style) string {
+	if width <= 0 {
+		width = defaultWidth
+	}
+
+	columnWidth := (max(width, minSideBySideWidth) - runewidth.StringWidth(sideBySideSeparator)) / 2
+
+	var builder strings.Builder
+
+	headerStyle := theme[cdiff.OpenHeader]
+	writeRow(&builder, columnWidth,
+		[]segment{{text: []rune("--- "), style: headerStyle}, {text: []rune(titleA), style: headerStyle}},
+		[]segment{{text: []rune("+++ "), style: headerStyle}, {text: []rune(titleB), style: headerStyle}},
+	)
+
+	for _, block := range groupLines(result.Lines, contextLines) {
+		lines := result.Lines[block.start : block.end+1]
+
+		builder.WriteString(theme[cdiff.OpenSection].Sprint(sectionHeader(lines)))
+		builder.WriteString("\n")
+
+		for i := 0; i < len(lines); {
+			if lines[i].Ope == cdiff.Keep {
+				writeRow(&builder, columnWidth, lineSegments(lines[i], theme), lineSegments(lines[i], theme))
+				i++
+				continue
+			}
+
+			// pair up a run of deleted lines with the run of inserted lines
+			// that directly follows it
+			var deleted, inserted []cdiff.Line
+			for ; i < len(lines) && lines[i].Ope == cdiff.Delete; i++ {
+				deleted = append(deleted, lines[i])
+			}
+			for ; i < len(lines) && lines[i].Ope == cdiff.Insert; i++ {
+				inserted = append(inserted, lines[i])
+			}
+
+			for j := 0; j < max(len(deleted), len(inserted)); j++ {
+				var left, right []segment
+				if j < len(deleted) {
+					left = lineSegments(deleted[j], theme)
+				}
+				if j < len(inserted) {
+					right = lineSegments(inserted[j], theme)
+				}
+
+				writeRow(&builder, columnWidth, left, right)
+			}
+		}
+	}
+
+	return builder.String()
+}
+
+// lineSegments turns a line into styled segments, starting with the +/-
+// marker.
+func lineSegments(line cdiff.Line, theme map[cdiff.Tag]color.Style) []segment {
+	var marker string
+	var modified, notModified color.Style
+
+	switch line.Ope {
+	case cdiff.Delete:
+		marker = "-"
+		modified, notModified = theme[cdiff.OpenDeletedModified], theme[cdiff.OpenDeletedNotModified]
+	case cdiff.Insert:
+		marker = "+"
+		modified, notModified = theme[cdiff.OpenInsertedModified], theme[cdiff.OpenInsertedNotModified]
+	default:
+		marker = " "
+	}
+
+	segments := []segment{{text: []rune(marker), style: notModified}}
+	column := 0
+
+	for _, fragment := range line.Fragments {
+		style := notModified
+		if fragment.Changed {
+			style = modified
+		}
+
+		var text []rune
+		text, column = expandTabs(fragment.Text, column)
+
+		segments = append(segments, segment{text: text, style: style})
+	}
+
+	return segments
+}
+
+// expandTabs replaces tabs with spaces up to the next tab stop, so that the
+// text has a known width. column is the width of the text before.
+func expandTabs(text string, column int) ([]rune, int) {
+	expanded := []rune{}
+
+	for _, r := range text {
+		if r == '\t' {
+			spaces := tabWidth - column%tabWidth
+			expanded = append(expanded, []rune(strings.Repeat(" ", spaces))...)
+			column += spaces
+			continue
+		}
+
+		expanded = append(expanded, r)
+		column += runewidth.RuneWidth(r)
+	}
+
+	return expanded, column
+}
+
+// writeRow writes both sides next to each other, wrapping them into as many
+// lines as needed. The first segment of each side is the marker and is kept
+// in its own column, so that wrapped lines are indented.
+func writeRow(builder *strings.Builder, columnWidth int, left, right []segment) {
+	leftLines := wrapLine(left, columnWidth)
+	rightLines := wrapLine(right, columnWidth)
+
+	for i := 0; i < max(len(leftLines), len(rightLines)); i++ {
+		var leftLine, rightLine []segment
+		if i < len(leftLines) {
+			leftLine = leftLines[i]
+		}
+		if i < len(rightLines) {
+			rightLine = rightLines[i]
+		}
+
+		length := writeSegments(builder, leftLine)
+		builder.WriteString(strings.Repeat(" ", max(0, columnWidth-length)))
+		builder.WriteString(sideBySideSeparator)
+		writeSegments(builder, rightLine)
+		builder.WriteString("\n")
+	}
+}
+
+// writeSegments writes the segments and returns their width in terminal
+// cells.
+func writeSegments(builder *strings.Builder, segments []segment) int {
+	length := 0
+	for _, s := range segments {
+		builder.WriteString(s.style.Sprint(string(s.text)))
+		length += runewidth.StringWidth(string(s.text))
+	}
+
+	return length
+}
+
+// wrapLine wraps the segments after the marker and prefixes the first line
+// with the marker and all further lines with a space.
+func wrapLine(segments []segment, width int) [][]segment {
+	if len(segments) == 0 {
+		return nil
+	}
+
+	marker := segments[0]
+	markerWidth := runewidth.StringWidth(string(marker.text))
+	lines := wrapSegments(segments[1:], width-markerWidth)
+
+	for i, line := range lines {
+		prefix := marker
+		if i > 0 {
+			prefix = segment{text: []rune(strings.Repeat(" ", markerWidth))}
+		}
+
+		lines[i] = append([]segment{prefix}, line...)
+	}
+
+	return lines
+}
+
+// wrapSegments splits the segments into lines that are at most width
+// terminal cells wide. Wide characters (like CJK or emoji) take up two cells.
+func wrapSegments(segments []segment, width int) [][]segment {
+	lines := [][]segment{}
+	current := []segment{}
+	currentLength := 0
+
+	for _, s := range segments {
+		text := s.text
+		for len(text) > 0 {
+			// take as many runes as fit, but at least one per line
+			n, length := 0, 0
+			for ; n < len(text); n++ {
+				runeWidth := runewidth.RuneWidth(text[n])
+				if currentLength+length+runeWidth > width && currentLength+length > 0 {
+					break
+				}
+
+				length += runeWidth
+			}
+
+			if n == 0 {
+				lines = append(lines, current)
+				current = []segment{}
+				currentLength = 0
+				continue
+			}
+
+			current = append(current, segment{text: text[:n], style: s.style})
+			currentLength += length
+			text = text[n:]
+		}
+	}
+
+	if len(current) > 0 || len(lines) == 0 {
+		lines = append(lines, current)
+	}
+
+	return lines
+}
+
+type lineBlock struct {
+	start int
+	end   int
+}
+
+// groupLines determines the ranges of lines that contain changes, including
+// the given number of context lines around them. Overlapping ranges are
+// merged.
+func groupLines(lines []cdiff.Line, contextLines int) []lineBlock {
+	blocks := []lineBlock{}
+
+	for i, line := range lines {
+		if line.Ope == cdiff.Keep {
+			continue
+		}
+
+		start := max(0, i-contextLines)
+		end := min(len(lines)-1, i+contextLines)
+
+		if len(blocks) > 0 && blocks[len(blocks)-1].end >= start-1 {
+			blocks[len(blocks)-1].end = end
+		} else {
+			blocks = append(blocks, lineBlock{start: start, end: end})
+		}
+	}
+
+	return blocks
+}
+
+// sectionHeader returns the "@@ -1,4 +1,5 @@" header for the given lines.
+func sectionHeader(lines []cdiff.Line) string {
+	oldStart, oldCount := 0, 0
+	newStart, newCount := 0, 0
+
+	for _, line := range lines {
+		if line.Ope != cdiff.Insert {
+			if oldCount == 0 {
+				oldStart = line.OldLineNumber
+			}
+			oldCount++
+		}
+
+		if line.Ope != cdiff.Delete {
+			if newCount == 0 {
+				newStart = line.NewLineNumber
+			}
+			newCount++
+		}
+	}
+
+	return fmt.Sprintf("@@ -%d,%d +%d,%d @@", oldStart, oldCount, newStart, newCount)
+}
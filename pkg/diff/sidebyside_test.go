@@ -0,0 +1,107 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package diff
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/shibukawa/cdiff"
+)
+
+func TestGroupLines(t *testing.T) {
+	k := cdiff.Line{Ope: cdiff.Keep}
+	d := cdiff.Line{Ope: cdiff.Delete}
+	i := cdiff.Line{Ope: cdiff.Insert}
+
+	testcases := []struct {
+		name         string
+		lines        []cdiff.Line
+		contextLines int
+		expected     []lineBlock
+	}{
+		{
+			name:         "no changes",
+			lines:        []cdiff.Line{k, k, k},
+			contextLines: 1,
+			expected:     []lineBlock{},
+		},
+		{
+			name:         "single change with context",
+			lines:        []cdiff.Line{k, k, d, i, k, k},
+			contextLines: 1,
+			expected:     []lineBlock{{start: 1, end: 4}},
+		},
+		{
+			name:         "context is limited to available lines",
+			lines:        []cdiff.Line{d, k},
+			contextLines: 3,
+			expected:     []lineBlock{{start: 0, end: 1}},
+		},
+		{
+			name:         "distant changes are separate blocks",
+			lines:        []cdiff.Line{d, k, k, k, k, i},
+			contextLines: 1,
+			expected:     []lineBlock{{start: 0, end: 1}, {start: 4, end: 5}},
+		},
+		{
+			name:         "adjacent blocks are merged",
+			lines:        []cdiff.Line{d, k, k, i},
+			contextLines: 1,
+			expected:     []lineBlock{{start: 0, end: 3}},
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			blocks := groupLines(testcase.lines, testcase.contextLines)
+			if !reflect.DeepEqual(blocks, testcase.expected) {
+				t.Errorf("Expected %v, but got %v.", testcase.expected, blocks)
+			}
+		})
+	}
+}
+
+func TestRenderSideBySide(t *testing.T) {
+	oldDoc := "a: 1\nb: a rather long value\nc: 3\n"
+	newDoc := "a: 1\nb: another rather long value\nc: 3\nd: 4\n"
+
+	// 2 columns of 20 characters each
+	output := renderSideBySide(cdiff.Diff(oldDoc, newDoc, cdiff.WordByWord), "old", "new", 1, 43, nil)
+
+	expected := []string{
+		"--- old              │ +++ new",
+		"@@ -1,3 +1,4 @@",
+		" a: 1                │  a: 1",
+		"-b: a rather long va │ +b: another rather l",
+		" lue                 │  ong value",
+		" c: 3                │  c: 3",
+		"                     │ +d: 4",
+	}
+
+	if lines := strings.Split(strings.TrimSuffix(output, "\n"), "\n"); !reflect.DeepEqual(lines, expected) {
+		t.Errorf("Expected\n\n%s\n\nbut got\n\n%s", strings.Join(expected, "\n"), strings.Join(lines, "\n"))
+	}
+}
+
+func TestRenderSideBySideWidths(t *testing.T) {
+	oldDoc := "a: |\n  x\ty\nb: 日本語の値です\n"
+	newDoc := "a: |\n  x\tz\nb: 日本語の新しい値です\n"
+
+	// 2 columns of 20 cells each
+	output := renderSideBySide(cdiff.Diff(oldDoc, newDoc, cdiff.WordByWord), "old", "new", 0, 43, nil)
+
+	expected := []string{
+		"--- old              │ +++ new",
+		"@@ -2,2 +2,2 @@",
+		"-  x     y           │ +  x     z",
+		"-b: 日本語の値です   │ +b: 日本語の新しい値",
+		"                     │  です",
+	}
+
+	if lines := strings.Split(strings.TrimSuffix(output, "\n"), "\n"); !reflect.DeepEqual(lines, expected) {
+		t.Errorf("Expected\n\n%s\n\nbut got\n\n%s", strings.Join(expected, "\n"), strings.Join(lines, "\n"))
+	}
+}
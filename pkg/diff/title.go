@@ -0,0 +1,179 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package diff
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// TitleData is the data available to title templates.
+type TitleData struct {
+	APIVersion string
+	Kind       string
+	Namespace  string
+	Name       string
+	// Key is "namespace/name" for namespaced and "name" for cluster-wide objects.
+	Key             string
+	UID             string
+	ResourceVersion string
+	Generation      int64
+	Labels          map[string]string
+	Annotations     map[string]string
+	// Owner is "Kind/name" of the controlling owner, or of the first owner if
+	// no owner is marked as the controller.
+	Owner string
+	// FieldManager is the manager of the most recently updated managedFields entry.
+	FieldManager string
+	Cluster      string
+	// Timestamp is the time when this version of the object was seen.
+	Timestamp time.Time
+	// SinceLastChange is the time between seeing the previous and this version.
+	SinceLastChange time.Duration
+	// User, Verb, UserAgent and SourceIP describe who made the change; they
+	// are only known for some sources, like audit logs.
+	User      string
+	Verb      string
+	UserAgent string
+	SourceIP  string
+	// Managers are the field managers whose managedFields changed. If none
+	// changed, FieldManager is the best guess.
+	Managers []string
+}
+
+func parseTitleTemplate(tpl string) (*template.Template, error) {
+	return template.New("title").Option("missingkey=zero").Parse(tpl)
+}
+
+// titleShowsMetadata returns true if the title template uses the labels or
+// annotations of objects.
+func titleShowsMetadata(tpl string) bool {
+	return strings.Contains(tpl, ".Labels") || strings.Contains(tpl, ".Annotations")
+}
+
+// diffTitle renders the header for one side of the diff. previous is the time
+// when the previous version of the object was seen (zero if unknown). actor,
+// managers and the probable manager (if no managers were detected) are
+// optional.
+func (d *Differ) diffTitle(obj *unstructured.Unstructured, seen, previous time.Time, actor *Actor, managers []string, probable string) string {
+	if obj == nil {
+		if actor != nil {
+			return fmt.Sprintf("(deleted by %s)", actor)
+		}
+
+		return "(none)"
+	}
+
+	// labels and annotations can contain redacted values
+	obj = d.redactObject(obj)
+
+	if d.opt.compiledTitleTemplate == nil {
+		return defaultDiffTitle(obj, seen, actor, managers, probable)
+	}
+
+	data := newTitleData(obj, seen, previous, d.opt.Cluster, actor)
+	data.Managers = managers
+
+	var buf bytes.Buffer
+	if err := d.opt.compiledTitleTemplate.Execute(&buf, data); err != nil {
+		d.log.Warnf("Failed to render title template: %v", err)
+		return defaultDiffTitle(obj, seen, actor, managers, probable)
+	}
+
+	// the title must fit into a single line
+	return strings.Join(strings.Fields(buf.String()), " ")
+}
+
+func defaultDiffTitle(obj *unstructured.Unstructured, seen time.Time, actor *Actor, managers []string, probable string) string {
+	timestamp := seen.Format(time.RFC3339)
+	kind := obj.GroupVersionKind().Kind
+
+	title := fmt.Sprintf("%s %s v%s (%s) (gen. %d)", kind, objectKey(obj), obj.GetResourceVersion(), timestamp, obj.GetGeneration())
+	if actor != nil {
+		title += " by " + actor.String()
+	}
+
+	switch {
+	case len(managers) > 0:
+		title += fmt.Sprintf(" (managers: %s)", strings.Join(managers, ", "))
+	case probable != "":
+		title += fmt.Sprintf(" (managers: probably %s)", probable)
+	}
+
+	return title
+}
+
+func newTitleData(obj *unstructured.Unstructured, seen, previous time.Time, cluster string, actor *Actor) TitleData {
+	data := TitleData{
+		APIVersion:      obj.GetAPIVersion(),
+		Kind:            obj.GetKind(),
+		Namespace:       obj.GetNamespace(),
+		Name:            obj.GetName(),
+		Key:             objectKey(obj),
+		UID:             string(obj.GetUID()),
+		ResourceVersion: obj.GetResourceVersion(),
+		Generation:      obj.GetGeneration(),
+		Labels:          obj.GetLabels(),
+		Annotations:     obj.GetAnnotations(),
+		Owner:           ownerName(obj.GetOwnerReferences()),
+		FieldManager:    latestFieldManager(obj.GetManagedFields()),
+		Cluster:         cluster,
+		Timestamp:       seen,
+	}
+
+	if !previous.IsZero() {
+		data.SinceLastChange = seen.Sub(previous).Round(time.Millisecond)
+	}
+
+	if actor != nil {
+		data.User = actor.Username
+		data.Verb = actor.Verb
+		data.UserAgent = actor.UserAgent
+		data.SourceIP = actor.SourceIP
+	}
+
+	return data
+}
+
+func ownerName(owners []metav1.OwnerReference) string {
+	if len(owners) == 0 {
+		return ""
+	}
+
+	owner := owners[0]
+	for _, o := range owners {
+		if o.Controller != nil && *o.Controller {
+			owner = o
+			break
+		}
+	}
+
+	return fmt.Sprintf("%s/%s", owner.Kind, owner.Name)
+}
+
+func latestFieldManager(entries []metav1.ManagedFieldsEntry) string {
+	var (
+		manager string
+		latest  time.Time
+	)
+
+	for _, entry := range entries {
+		if entry.Time == nil {
+			continue
+		}
+
+		if manager == "" || entry.Time.After(latest) {
+			manager = entry.Manager
+			latest = entry.Time.Time
+		}
+	}
+
+	return manager
+}
@@ -0,0 +1,159 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package diff
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestDiffTitle(t *testing.T) {
+	seen := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	obj := parseObject(t, `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  namespace: default
+  resourceVersion: "42"
+  labels: {app: web}
+  ownerReferences:
+  - {apiVersion: v1, kind: First, name: first, uid: "1"}
+  - {apiVersion: v1, kind: Controller, name: ctrl, uid: "2", controller: true}
+  managedFields:
+  - {manager: old, operation: Update, time: "2023-01-01T00:00:00Z"}
+  - {manager: new, operation: Update, time: "2023-01-02T00:00:00Z"}
+  - {manager: untimed, operation: Apply}
+`)
+
+	// YAML numbers are decoded as floats, which would be ignored
+	obj.SetGeneration(3)
+
+	testcases := []struct {
+		name     string
+		template string
+		obj      *unstructured.Unstructured
+		previous time.Time
+		actor    *Actor
+		managers []string
+		probable string
+		expected string
+	}{
+		{
+			name:     "default title",
+			obj:      obj,
+			expected: "Deployment default/web v42 (2023-01-02T03:04:05Z) (gen. 3)",
+		},
+		{
+			name:     "default title with actor and managers",
+			obj:      obj,
+			actor:    &Actor{Username: "alice", Verb: "patch"},
+			managers: []string{"kubectl", "helm"},
+			expected: "Deployment default/web v42 (2023-01-02T03:04:05Z) (gen. 3) by alice (patch) (managers: kubectl, helm)",
+		},
+		{
+			name:     "default title with probable manager",
+			obj:      obj,
+			probable: "helm",
+			expected: "Deployment default/web v42 (2023-01-02T03:04:05Z) (gen. 3) (managers: probably helm)",
+		},
+		{
+			name:     "deleted object",
+			expected: "(none)",
+		},
+		{
+			name:     "deleted object with actor",
+			actor:    &Actor{Username: "alice", Verb: "delete"},
+			expected: "(deleted by alice (delete))",
+		},
+		{
+			name:     "object fields",
+			template: "{{ .Kind }} {{ .Key }} {{ .APIVersion }} {{ .ResourceVersion }} {{ .Generation }} {{ .Labels.app }}",
+			obj:      obj,
+			expected: "Deployment default/web apps/v1 42 3 web",
+		},
+		{
+			name:     "controller is preferred as owner",
+			template: "{{ .Owner }}",
+			obj:      obj,
+			expected: "Controller/ctrl",
+		},
+		{
+			name:     "first owner without controller",
+			template: "{{ .Owner }}",
+			obj:      parseObject(t, `{apiVersion: v1, kind: Pod, metadata: {name: a, ownerReferences: [{apiVersion: v1, kind: First, name: first, uid: "1"}]}}`),
+			expected: "First/first",
+		},
+		{
+			name:     "latest field manager",
+			template: "{{ .FieldManager }}",
+			obj:      obj,
+			expected: "new",
+		},
+		{
+			name:     "time since the last change",
+			template: "{{ .Timestamp.Format \"15:04\" }} {{ .SinceLastChange }}",
+			obj:      obj,
+			previous: seen.Add(-90 * time.Second),
+			expected: "03:04 1m30s",
+		},
+		{
+			name:     "unknown previous version",
+			template: "{{ if .SinceLastChange }}changed{{ else }}first{{ end }}",
+			obj:      obj,
+			expected: "first",
+		},
+		{
+			name:     "actor and managers",
+			template: "{{ .User }} {{ .Verb }} {{ .UserAgent }} {{ .SourceIP }} {{ range .Managers }}[{{ . }}]{{ end }}",
+			obj:      obj,
+			actor:    &Actor{Username: "alice", Verb: "patch", UserAgent: "kubectl", SourceIP: "10.0.0.1"},
+			managers: []string{"kubectl", "helm"},
+			expected: "alice patch kubectl 10.0.0.1 [kubectl][helm]",
+		},
+		{
+			name:     "missing values are empty",
+			template: "{{ .Kind }}:{{ .Labels.missing }}:{{ .Annotations.missing }}:{{ .User }}",
+			obj:      parseObject(t, `{apiVersion: v1, kind: Pod, metadata: {name: a}}`),
+			expected: "Pod:::",
+		},
+		{
+			name:     "titles are a single line",
+			template: "{{ .Kind }}\n  {{ .Name }}\t!",
+			obj:      obj,
+			expected: "Deployment web !",
+		},
+		{
+			name:     "failing templates fall back to the default title",
+			template: "{{ .Name.Foo }}",
+			obj:      obj,
+			expected: "Deployment default/web v42 (2023-01-02T03:04:05Z) (gen. 3)",
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			differ, err := NewDiffer(&Options{TitleTemplate: testcase.template}, logrus.New())
+			if err != nil {
+				t.Fatalf("Failed to create differ: %v", err)
+			}
+
+			title := differ.diffTitle(testcase.obj, seen, testcase.previous, testcase.actor, testcase.managers, testcase.probable)
+			if title != testcase.expected {
+				t.Errorf("Expected %q, but got %q.", testcase.expected, title)
+			}
+		})
+	}
+}
+
+func TestInvalidTitleTemplate(t *testing.T) {
+	if _, err := NewDiffer(&Options{TitleTemplate: "{{ .Kind "}, logrus.New()); err == nil {
+		t.Error("Expected an invalid template to be rejected.")
+	}
+}
@@ -0,0 +1,158 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package diff
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+// truncateContext is the maximum number of unchanged characters shown
+// around the changed region of a long value.
+const truncateContext = 20
+
+// truncateValues replaces all strings longer than maxLength in both
+// (preprocessed) values with a summary. Values that exist on both sides and
+// changed are reduced to the changed region, so that the diff shows what
+// changed within them; all other long values are reduced to a prefix.
+func truncateValues(oldValue, newValue interface{}, maxLength int) (interface{}, interface{}) {
+	switch oldTyped := oldValue.(type) {
+	case map[string]interface{}:
+		newTyped, ok := newValue.(map[string]interface{})
+		if !ok {
+			break
+		}
+
+		for key, oldChild := range oldTyped {
+			if newChild, exists := newTyped[key]; exists {
+				oldTyped[key], newTyped[key] = truncateValues(oldChild, newChild, maxLength)
+			} else {
+				oldTyped[key] = truncateAll(oldChild, maxLength)
+			}
+		}
+
+		for key, newChild := range newTyped {
+			if _, exists := oldTyped[key]; !exists {
+				newTyped[key] = truncateAll(newChild, maxLength)
+			}
+		}
+
+		return oldTyped, newTyped
+
+	case []interface{}:
+		newTyped, ok := newValue.([]interface{})
+		if !ok {
+			break
+		}
+
+		for i := 0; i < min(len(oldTyped), len(newTyped)); i++ {
+			oldTyped[i], newTyped[i] = truncateValues(oldTyped[i], newTyped[i], maxLength)
+		}
+
+		for i := len(newTyped); i < len(oldTyped); i++ {
+			oldTyped[i] = truncateAll(oldTyped[i], maxLength)
+		}
+
+		for i := len(oldTyped); i < len(newTyped); i++ {
+			newTyped[i] = truncateAll(newTyped[i], maxLength)
+		}
+
+		return oldTyped, newTyped
+
+	case string:
+		if newTyped, ok := newValue.(string); ok && oldTyped != newTyped {
+			return truncateChanged(oldTyped, newTyped, maxLength)
+		}
+	}
+
+	// values of different types or unchanged strings
+	return truncateAll(oldValue, maxLength), truncateAll(newValue, maxLength)
+}
+
+// truncateAll summarizes all long strings in the value.
+func truncateAll(value interface{}, maxLength int) interface{} {
+	switch asserted := value.(type) {
+	case map[string]interface{}:
+		for key, child := range asserted {
+			asserted[key] = truncateAll(child, maxLength)
+		}
+
+		return asserted
+
+	case []interface{}:
+		for i, item := range asserted {
+			asserted[i] = truncateAll(item, maxLength)
+		}
+
+		return asserted
+
+	case string:
+		return truncateString(asserted, maxLength)
+	}
+
+	return value
+}
+
+func truncateString(value string, maxLength int) string {
+	runes := []rune(value)
+	if len(runes) <= maxLength {
+		return value
+	}
+
+	return valueSummary(string(runes[:maxLength])+"…", value)
+}
+
+// truncateChanged shows only the changed region of both strings, plus a few
+// characters of context. If both are short enough, they are kept as is.
+func truncateChanged(oldValue, newValue string, maxLength int) (string, string) {
+	oldRunes := []rune(oldValue)
+	newRunes := []rune(newValue)
+
+	if len(oldRunes) <= maxLength && len(newRunes) <= maxLength {
+		return oldValue, newValue
+	}
+
+	prefix := 0
+	for prefix < len(oldRunes) && prefix < len(newRunes) && oldRunes[prefix] == newRunes[prefix] {
+		prefix++
+	}
+
+	suffix := 0
+	for suffix < len(oldRunes)-prefix && suffix < len(newRunes)-prefix && oldRunes[len(oldRunes)-1-suffix] == newRunes[len(newRunes)-1-suffix] {
+		suffix++
+	}
+
+	// the context must not take up the entire excerpt, otherwise short
+	// excerpts would not show the changed characters at all
+	context := min(truncateContext, maxLength/4)
+	start := max(0, prefix-context)
+
+	return changedRegion(oldRunes, start, len(oldRunes)-suffix, context, maxLength), changedRegion(newRunes, start, len(newRunes)-suffix, context, maxLength)
+}
+
+// changedRegion summarizes the value, showing the runes from start to end
+// (plus context after the end), but at most maxLength runes.
+func changedRegion(runes []rune, start, end int, context int, maxLength int) string {
+	end = min(len(runes), end+context, start+maxLength)
+
+	excerpt := string(runes[start:end])
+	if start > 0 {
+		excerpt = "…" + excerpt
+	}
+
+	if end < len(runes) {
+		excerpt += "…"
+	}
+
+	return valueSummary(excerpt, string(runes))
+}
+
+// valueSummary appends the length and hash of the full value to the excerpt,
+// so that values with the same excerpt can still be told apart.
+func valueSummary(excerpt string, value string) string {
+	hash := sha256.Sum256([]byte(value))
+
+	return fmt.Sprintf("%s (%d characters, sha256:%s)", excerpt, len([]rune(value)), hex.EncodeToString(hash[:])[:12])
+}
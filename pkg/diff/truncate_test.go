@@ -0,0 +1,109 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package diff
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTruncateValues(t *testing.T) {
+	long := strings.Repeat("a", 50) + "MIDDLE" + strings.Repeat("b", 50)
+	changed := strings.Repeat("a", 50) + "CHANGED" + strings.Repeat("b", 50)
+
+	testcases := []struct {
+		name        string
+		old         interface{}
+		new         interface{}
+		expectedOld interface{}
+		expectedNew interface{}
+	}{
+		{
+			name:        "short values are kept",
+			old:         map[string]interface{}{"foo": "bar"},
+			new:         map[string]interface{}{"foo": "baz"},
+			expectedOld: map[string]interface{}{"foo": "bar"},
+			expectedNew: map[string]interface{}{"foo": "baz"},
+		},
+		{
+			name:        "unchanged values are truncated",
+			old:         map[string]interface{}{"foo": long},
+			new:         map[string]interface{}{"foo": long},
+			expectedOld: map[string]interface{}{"foo": valueSummary(strings.Repeat("a", 10)+"…", long)},
+			expectedNew: map[string]interface{}{"foo": valueSummary(strings.Repeat("a", 10)+"…", long)},
+		},
+		{
+			name:        "created objects are truncated",
+			old:         nil,
+			new:         []interface{}{long, 42},
+			expectedOld: nil,
+			expectedNew: []interface{}{valueSummary(strings.Repeat("a", 10)+"…", long), 42},
+		},
+		{
+			name:        "changed values are reduced to the changed region",
+			old:         []interface{}{long},
+			new:         []interface{}{changed},
+			expectedOld: []interface{}{valueSummary("…aaMIDDLEbb…", long)},
+			expectedNew: []interface{}{valueSummary("…aaCHANGEDb…", changed)},
+		},
+		{
+			name:        "added list items are truncated",
+			old:         []interface{}{"x"},
+			new:         []interface{}{"x", long},
+			expectedOld: []interface{}{"x"},
+			expectedNew: []interface{}{"x", valueSummary(strings.Repeat("a", 10)+"…", long)},
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			oldResult, newResult := truncateValues(testcase.old, testcase.new, 10)
+
+			if !reflect.DeepEqual(testcase.expectedOld, oldResult) {
+				t.Errorf("Expected old value %v, but got %v.", testcase.expectedOld, oldResult)
+			}
+
+			if !reflect.DeepEqual(testcase.expectedNew, newResult) {
+				t.Errorf("Expected new value %v, but got %v.", testcase.expectedNew, newResult)
+			}
+		})
+	}
+}
+
+func TestTruncateChanged(t *testing.T) {
+	oldValue := strings.Repeat("a", 50) + "MIDDLE" + strings.Repeat("b", 50)
+	newValue := strings.Repeat("a", 50) + "CHANGED" + strings.Repeat("b", 50)
+
+	oldResult, newResult := truncateChanged(oldValue, newValue, 100)
+
+	expectedOld := valueSummary("…"+strings.Repeat("a", truncateContext)+"MIDDLE"+strings.Repeat("b", truncateContext)+"…", oldValue)
+	if oldResult != expectedOld {
+		t.Errorf("Expected %q, but got %q.", expectedOld, oldResult)
+	}
+
+	expectedNew := valueSummary("…"+strings.Repeat("a", truncateContext)+"CHANGED"+strings.Repeat("b", truncateContext)+"…", newValue)
+	if newResult != expectedNew {
+		t.Errorf("Expected %q, but got %q.", expectedNew, newResult)
+	}
+}
+
+func TestTruncateChangedShowsChange(t *testing.T) {
+	oldValue := strings.Repeat("a", 50) + "MIDDLE" + strings.Repeat("b", 50)
+	newValue := strings.Repeat("a", 50) + "CHANGED" + strings.Repeat("b", 50)
+
+	// no matter how short the excerpt is, the first changed character must
+	// be part of it
+	for maxLength := 1; maxLength <= 40; maxLength++ {
+		oldResult, newResult := truncateChanged(oldValue, newValue, maxLength)
+
+		if !strings.Contains(oldResult, "M") {
+			t.Errorf("Expected %q to contain the changed region with max length %d.", oldResult, maxLength)
+		}
+
+		if !strings.Contains(newResult, "C") {
+			t.Errorf("Expected %q to contain the changed region with max length %d.", newResult, maxLength)
+		}
+	}
+}
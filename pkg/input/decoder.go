@@ -0,0 +1,287 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package input
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	yamlutil "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// Event is a single object read from an input, together with what happened
+// to it.
+type Event struct {
+	Type   watch.EventType
+	Object *unstructured.Unstructured
+}
+
+// Decoder reads a stream of YAML or JSON documents. Documents can either be
+// plain objects, which are treated as modifications, or watch events like
+// {"type": "ADDED", "object": {...}}, as produced by the Kubernetes watch API
+// and `kubectl get --watch --output-watch-events`. Lists (like the output of
+// `kubectl get -o yaml`) are treated as complete snapshots of the kinds they
+// contain, so objects that are missing from the next list containing their
+// kind are reported as deleted.
+type Decoder struct {
+	decoder   *yamlutil.YAMLOrJSONDecoder
+	snapshots map[schema.GroupKind]*Snapshot
+	pending   []Event
+}
+
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{
+		decoder:   yamlutil.NewYAMLOrJSONDecoder(r, 1024),
+		snapshots: map[schema.GroupKind]*Snapshot{},
+	}
+}
+
+// Next returns the next event in the stream or io.EOF if the stream has
+// ended.
+func (d *Decoder) Next() (*Event, error) {
+	// lists can result in any number of events, including none at all
+	for len(d.pending) == 0 {
+		document, err := d.decode()
+		if err != nil {
+			return nil, err
+		}
+
+		items, isList := listItems(document)
+		if !isList {
+			return d.event(document), nil
+		}
+
+		d.pending = d.updateSnapshots(document, items)
+	}
+
+	event := d.pending[0]
+	d.pending = d.pending[1:]
+
+	return &event, nil
+}
+
+// Run reads events until the stream ends or the context is cancelled and
+// calls the handler for every object. Bookmarks are skipped and watch errors
+// are logged.
+func (d *Decoder) Run(ctx context.Context, log logrus.FieldLogger, handler func(*Event)) {
+	events := make(chan *Event)
+
+	// reading cannot be interrupted, so the reader is abandoned on cancellation
+	go func() {
+		defer close(events)
+
+		for {
+			event, err := d.Next()
+			if err != nil {
+				if errors.Is(err, io.EOF) {
+					return
+				}
+
+				log.Errorf("Failed to decode YAML object: %v", err)
+				continue
+			}
+
+			select {
+			case events <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+
+			switch event.Type {
+			case watch.Bookmark:
+			case watch.Error:
+				log.Errorf("Watch error: %s", ErrorMessage(event))
+			default:
+				handler(event)
+			}
+		}
+	}
+}
+
+// updateSnapshots updates the snapshot of every kind in the list, so that
+// alternating lists of different kinds (e.g. repeated `kubectl get deploy`
+// and `kubectl get cm`) do not delete each other's objects. Kinds that are
+// not part of a list at all cannot be told apart from kinds that were not
+// requested, so a generic empty List does not delete anything, while an empty
+// typed list (like a PodList) deletes all objects of its kind.
+func (d *Decoder) updateSnapshots(list map[string]interface{}, items []*unstructured.Unstructured) []Event {
+	kinds := []schema.GroupKind{}
+	itemsByKind := map[schema.GroupKind][]*unstructured.Unstructured{}
+
+	if listKind := typedListKind(list); listKind != nil {
+		kinds = append(kinds, *listKind)
+		itemsByKind[*listKind] = []*unstructured.Unstructured{}
+	}
+
+	for _, item := range items {
+		kind := item.GroupVersionKind().GroupKind()
+		if _, exists := itemsByKind[kind]; !exists {
+			kinds = append(kinds, kind)
+		}
+
+		itemsByKind[kind] = append(itemsByKind[kind], item)
+	}
+
+	events := []Event{}
+	for _, kind := range kinds {
+		snapshot, exists := d.snapshots[kind]
+		if !exists {
+			snapshot = NewSnapshot()
+			d.snapshots[kind] = snapshot
+		}
+
+		events = append(events, snapshot.Update(itemsByKind[kind])...)
+	}
+
+	return events
+}
+
+// typedListKind returns the kind of the items of a typed list (like
+// "PodList"), or nil for generic Lists.
+func typedListKind(list map[string]interface{}) *schema.GroupKind {
+	obj := &unstructured.Unstructured{Object: list}
+
+	kind := strings.TrimSuffix(obj.GetKind(), "List")
+	if kind == "" {
+		return nil
+	}
+
+	return &schema.GroupKind{
+		Group: obj.GroupVersionKind().Group,
+		Kind:  kind,
+	}
+}
+
+func (d *Decoder) decode() (map[string]interface{}, error) {
+	var document map[string]interface{}
+
+	// skip empty documents
+	for len(document) == 0 {
+		if err := d.decoder.Decode(&document); err != nil {
+			return nil, err
+		}
+	}
+
+	return document, nil
+}
+
+func (d *Decoder) event(document map[string]interface{}) *Event {
+	if event, ok := watchEvent(document); ok {
+		return event
+	}
+
+	return &Event{
+		Type:   watch.Modified,
+		Object: &unstructured.Unstructured{Object: document},
+	}
+}
+
+// listItems returns the items if the document is a List (e.g. "List" or
+// "PodList"). Custom resources whose kind ends in "List" have no items and
+// are regular objects.
+func listItems(document map[string]interface{}) ([]*unstructured.Unstructured, bool) {
+	kind, _ := document["kind"].(string)
+	if !strings.HasSuffix(kind, "List") {
+		return nil, false
+	}
+
+	rawItems, ok := document["items"].([]interface{})
+	if !ok {
+		return nil, false
+	}
+
+	items := []*unstructured.Unstructured{}
+	for _, rawItem := range rawItems {
+		if item, ok := rawItem.(map[string]interface{}); ok {
+			items = append(items, &unstructured.Unstructured{Object: item})
+		}
+	}
+
+	return items, true
+}
+
+// watchEvent checks if the document is a watch event envelope and if so,
+// unwraps it.
+func watchEvent(document map[string]interface{}) (*Event, bool) {
+	// regular objects (like Secrets) can have a type field, too
+	if _, ok := document["apiVersion"]; ok {
+		return nil, false
+	}
+
+	eventType, ok := document["type"].(string)
+	if !ok {
+		return nil, false
+	}
+
+	object, ok := document["object"].(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+
+	switch watch.EventType(eventType) {
+	case watch.Added, watch.Modified, watch.Deleted, watch.Bookmark, watch.Error:
+		return &Event{
+			Type:   watch.EventType(eventType),
+			Object: &unstructured.Unstructured{Object: object},
+		}, true
+
+	default:
+		return nil, false
+	}
+}
+
+// ErrorMessage returns a readable message for an ERROR watch event, whose
+// object is usually a metav1.Status.
+func ErrorMessage(event *Event) string {
+	message, _, _ := unstructured.NestedString(event.Object.Object, "message")
+	if message == "" {
+		message = fmt.Sprintf("%v", event.Object.Object)
+	}
+
+	return message
+}
+
+// ReadObjects reads all objects from a stream of YAML or JSON documents,
+// expanding Lists into their items.
+func ReadObjects(r io.Reader) ([]*unstructured.Unstructured, error) {
+	decoder := NewDecoder(r)
+	objects := []*unstructured.Unstructured{}
+
+	for {
+		document, err := decoder.decode()
+		if err != nil {
+			if err == io.EOF {
+				return objects, nil
+			}
+
+			return nil, err
+		}
+
+		if items, isList := listItems(document); isList {
+			objects = append(objects, items...)
+		} else {
+			objects = append(objects, &unstructured.Unstructured{Object: document})
+		}
+	}
+}
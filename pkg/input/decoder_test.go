@@ -0,0 +1,153 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package input
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+func TestDecoder(t *testing.T) {
+	testcases := []struct {
+		name     string
+		input    string
+		expected []watch.EventType
+		names    []string
+	}{
+		{
+			name: "plain YAML objects",
+			input: `
+apiVersion: v1
+kind: ConfigMap
+metadata: {name: a}
+---
+apiVersion: v1
+kind: Secret
+type: Opaque
+metadata: {name: b}
+`,
+			expected: []watch.EventType{watch.Modified, watch.Modified},
+			names:    []string{"a", "b"},
+		},
+		{
+			name: "JSON watch events",
+			input: `{"type": "ADDED", "object": {"apiVersion": "v1", "kind": "Pod", "metadata": {"name": "a"}}}
+{"type": "MODIFIED", "object": {"apiVersion": "v1", "kind": "Pod", "metadata": {"name": "a"}}}
+{"type": "DELETED", "object": {"apiVersion": "v1", "kind": "Pod", "metadata": {"name": "a"}}}`,
+			expected: []watch.EventType{watch.Added, watch.Modified, watch.Deleted},
+			names:    []string{"a", "a", "a"},
+		},
+		{
+			name: "YAML watch events and bookmarks",
+			input: `
+type: ADDED
+object: {apiVersion: v1, kind: Pod, metadata: {name: a}}
+---
+type: BOOKMARK
+object: {apiVersion: v1, kind: Pod, metadata: {resourceVersion: "12"}}
+`,
+			expected: []watch.EventType{watch.Added, watch.Bookmark},
+			names:    []string{"a", ""},
+		},
+		{
+			name: "lists are snapshots",
+			input: `
+apiVersion: v1
+kind: List
+items:
+- {apiVersion: v1, kind: Pod, metadata: {name: a}, spec: {x: 1}}
+- {apiVersion: v1, kind: Pod, metadata: {name: b}, spec: {x: 1}}
+---
+apiVersion: v1
+kind: List
+items:
+- {apiVersion: v1, kind: Pod, metadata: {name: b}, spec: {x: 2}}
+- {apiVersion: v1, kind: Pod, metadata: {name: c}, spec: {x: 1}}
+---
+apiVersion: v1
+kind: PodList
+items:
+- {apiVersion: v1, kind: Pod, metadata: {name: b}, spec: {x: 2}}
+- {apiVersion: v1, kind: Pod, metadata: {name: c}, spec: {x: 1}}
+`,
+			expected: []watch.EventType{watch.Added, watch.Added, watch.Modified, watch.Added, watch.Deleted},
+			names:    []string{"a", "b", "b", "c", "a"},
+		},
+		{
+			name: "lists of different kinds do not replace each other",
+			input: `
+apiVersion: v1
+kind: List
+items:
+- {apiVersion: apps/v1, kind: Deployment, metadata: {name: a}}
+---
+apiVersion: v1
+kind: List
+items:
+- {apiVersion: v1, kind: ConfigMap, metadata: {name: b}}
+---
+apiVersion: v1
+kind: List
+items:
+- {apiVersion: apps/v1, kind: Deployment, metadata: {name: a}, spec: {x: 1}}
+- {apiVersion: v1, kind: ConfigMap, metadata: {name: c}}
+---
+apiVersion: v1
+kind: List
+items: []
+---
+apiVersion: apps/v1
+kind: DeploymentList
+items: []
+`,
+			expected: []watch.EventType{watch.Added, watch.Added, watch.Modified, watch.Added, watch.Deleted, watch.Deleted},
+			names:    []string{"a", "b", "a", "c", "b", "a"},
+		},
+		{
+			name: "custom resources named like lists are objects",
+			input: `
+apiVersion: v1
+kind: List
+items:
+- {apiVersion: example.com/v1, kind: Access, metadata: {name: a}}
+---
+apiVersion: example.com/v1
+kind: AccessList
+metadata: {name: b}
+spec: {users: [alice]}
+`,
+			expected: []watch.EventType{watch.Added, watch.Modified},
+			names:    []string{"a", "b"},
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			decoder := NewDecoder(strings.NewReader(testcase.input))
+
+			for i, expected := range testcase.expected {
+				event, err := decoder.Next()
+				if err != nil {
+					t.Fatalf("Failed to decode document %d: %v", i+1, err)
+				}
+
+				if event.Type != expected {
+					t.Errorf("Expected document %d to be %s, but got %s.", i+1, expected, event.Type)
+				}
+
+				if name := event.Object.GetName(); name != testcase.names[i] {
+					t.Errorf("Expected document %d to be named %q, but got %q.", i+1, testcase.names[i], name)
+				}
+			}
+
+			if _, err := decoder.Next(); !errors.Is(err, io.EOF) {
+				t.Errorf("Expected EOF, but got %v.", err)
+			}
+		})
+	}
+}
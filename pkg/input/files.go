@@ -0,0 +1,266 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package input
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"go.xrstf.de/stalk/pkg/diff"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// FileWatcher polls local manifest files and directories for changes. All
+// objects in all files form a single snapshot, so objects that are moved
+// from one file to another are reported as modified, not as deleted and
+// added.
+type FileWatcher struct {
+	paths    []string
+	interval time.Duration
+	log      logrus.FieldLogger
+
+	snapshot *Snapshot
+	files    map[string]*manifestFile
+}
+
+type manifestFile struct {
+	size    int64
+	modTime time.Time
+	objects []*unstructured.Unstructured
+}
+
+func NewFileWatcher(paths []string, interval time.Duration, log logrus.FieldLogger) *FileWatcher {
+	return &FileWatcher{
+		paths:    paths,
+		interval: interval,
+		log:      log,
+		snapshot: NewSnapshot(),
+		files:    map[string]*manifestFile{},
+	}
+}
+
+// Run polls the files until the context is cancelled and calls the handler
+// for every added, modified or deleted object. An error is only returned if
+// one of the paths does not exist when starting.
+func (w *FileWatcher) Run(ctx context.Context, handler func(*Event)) error {
+	for _, path := range w.paths {
+		if _, err := os.Stat(path); err != nil {
+			return err
+		}
+	}
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		if w.poll() {
+			for _, event := range w.snapshot.Update(w.objects()) {
+				handler(&event)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll updates the list of files and re-reads those that changed. It returns
+// true if any file was added, changed or removed.
+func (w *FileWatcher) poll() bool {
+	changed := false
+	seen := map[string]struct{}{}
+
+	for _, filename := range w.manifestFiles() {
+		seen[filename] = struct{}{}
+
+		info, err := os.Stat(filename)
+		if err != nil {
+			// the file was removed while we were looking at it
+			continue
+		}
+
+		existing, exists := w.files[filename]
+		if exists && existing.size == info.Size() && existing.modTime.Equal(info.ModTime()) {
+			continue
+		}
+
+		objects, err := ReadManifest(filename, w.log)
+		if err != nil {
+			// files can be incomplete while they are being edited, so keep
+			// the previous objects to not report them as deleted
+			w.log.Warnf("Failed to read %s: %v", filename, err)
+
+			if !exists {
+				existing = &manifestFile{}
+				w.files[filename] = existing
+			}
+
+			existing.size = info.Size()
+			existing.modTime = info.ModTime()
+
+			continue
+		}
+
+		w.files[filename] = &manifestFile{
+			size:    info.Size(),
+			modTime: info.ModTime(),
+			objects: objects,
+		}
+
+		changed = true
+	}
+
+	for filename := range w.files {
+		if _, exists := seen[filename]; !exists {
+			delete(w.files, filename)
+			changed = true
+		}
+	}
+
+	return changed
+}
+
+func (w *FileWatcher) manifestFiles() []string {
+	return ListManifests(w.paths, w.log)
+}
+
+// ListManifests returns all files given directly and all YAML and JSON files
+// in the given directories, recursively. Hidden directories are skipped.
+func ListManifests(paths []string, log logrus.FieldLogger) []string {
+	files := []string{}
+
+	for _, path := range paths {
+		err := filepath.WalkDir(path, func(filename string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if entry.IsDir() {
+				// skip hidden directories like .git, but not "." itself
+				if filename != path && strings.HasPrefix(entry.Name(), ".") {
+					return filepath.SkipDir
+				}
+
+				return nil
+			}
+
+			if filename == path || isManifest(filename) {
+				files = append(files, filename)
+			}
+
+			return nil
+		})
+		if err != nil {
+			log.Warnf("Failed to list files in %s: %v", path, err)
+		}
+	}
+
+	return files
+}
+
+func (w *FileWatcher) objects() []*unstructured.Unstructured {
+	filenames := []string{}
+	for filename := range w.files {
+		filenames = append(filenames, filename)
+	}
+
+	sort.Strings(filenames)
+
+	objects := []*unstructured.Unstructured{}
+	sources := map[string]string{}
+
+	for _, filename := range filenames {
+		for _, obj := range w.files[filename].objects {
+			key := ObjectKey(obj)
+
+			// the snapshot can only contain each object once
+			if source, exists := sources[key]; exists {
+				w.log.Warnf("Ignoring %s %s in %s, it is already defined in %s.", obj.GetKind(), obj.GetName(), filename, source)
+				continue
+			}
+
+			sources[key] = filename
+			objects = append(objects, obj)
+		}
+	}
+
+	return objects
+}
+
+func isManifest(filename string) bool {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yaml", ".yml", ".json":
+		return true
+	default:
+		return false
+	}
+}
+
+// ReadManifest is like ReadFile, but skips documents that are not Kubernetes
+// objects (i.e. have no kind or name), like Helm values or kustomizations
+// that happen to be in the same directory.
+func ReadManifest(filename string, log logrus.FieldLogger) ([]*unstructured.Unstructured, error) {
+	objects, err := ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	manifests := []*unstructured.Unstructured{}
+	for i, obj := range objects {
+		if obj.GetKind() == "" || obj.GetName() == "" {
+			log.Debugf("Skipping document %d in %s, it has no kind or name.", i+1, filename)
+			continue
+		}
+
+		manifests = append(manifests, obj)
+	}
+
+	return manifests, nil
+}
+
+// LoadDesiredState reads all manifests from the given files and directories.
+func LoadDesiredState(paths []string, log logrus.FieldLogger) (*diff.DesiredState, error) {
+	desired := diff.NewDesiredState()
+
+	for _, filename := range ListManifests(paths, log) {
+		objects, err := ReadManifest(filename, log)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", filename, err)
+		}
+
+		for _, obj := range objects {
+			desired.Add(obj, filename)
+		}
+	}
+
+	return desired, nil
+}
+
+// ReadFile reads all objects from a YAML or JSON file.
+func ReadFile(filename string) ([]*unstructured.Unstructured, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	objects, err := ReadObjects(f)
+	if err != nil {
+		return nil, fmt.Errorf("invalid YAML: %w", err)
+	}
+
+	return objects, nil
+}
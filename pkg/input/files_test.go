@@ -0,0 +1,111 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package input
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+func TestFileWatcher(t *testing.T) {
+	dir := t.TempDir()
+
+	writeFile := func(filename, content string) {
+		path := filepath.Join(dir, filename)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+
+		// make sure the change is noticed even on filesystems with a coarse mtime
+		modTime := time.Now().Add(time.Duration(len(content)) * time.Second)
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatalf("Failed to update file time: %v", err)
+		}
+	}
+
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+
+	w := NewFileWatcher([]string{dir}, time.Second, log)
+
+	poll := func() []string {
+		result := []string{}
+		if w.poll() {
+			for _, event := range w.snapshot.Update(w.objects()) {
+				result = append(result, string(event.Type)+" "+event.Object.GetName())
+			}
+		}
+
+		return result
+	}
+
+	writeFile("a.yaml", "apiVersion: v1\nkind: ConfigMap\nmetadata: {name: a}\n---\napiVersion: v1\nkind: ConfigMap\nmetadata: {name: b}\n")
+	writeFile("ignored.txt", "not a manifest")
+	writeFile("c.json", `{"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "c"}}`)
+	writeFile("values.yaml", "replicas: 3\n")
+	writeFile("kustomization.yaml", "resources: [a.yaml]\n")
+
+	steps := []struct {
+		name     string
+		change   func()
+		expected []string
+	}{
+		{
+			name:     "initial objects are added",
+			change:   func() {},
+			expected: []string{string(watch.Added) + " a", string(watch.Added) + " b", string(watch.Added) + " c"},
+		},
+		{
+			name:     "nothing changed",
+			change:   func() {},
+			expected: []string{},
+		},
+		{
+			name: "object is modified and removed",
+			change: func() {
+				writeFile("a.yaml", "apiVersion: v1\nkind: ConfigMap\nmetadata: {name: a}\ndata: {foo: bar}\n")
+			},
+			expected: []string{string(watch.Modified) + " a", string(watch.Deleted) + " b"},
+		},
+		{
+			name: "duplicate objects are only added once",
+			change: func() {
+				writeFile("d.yaml", "apiVersion: v1\nkind: ConfigMap\nmetadata: {name: a}\ndata: {foo: duplicate}\n---\napiVersion: v1\nkind: ConfigMap\nmetadata: {name: d}\n")
+			},
+			expected: []string{string(watch.Added) + " d"},
+		},
+		{
+			name: "broken files keep their objects",
+			change: func() {
+				writeFile("a.yaml", "broken: [")
+			},
+			expected: []string{},
+		},
+		{
+			name: "removed files delete their objects",
+			change: func() {
+				if err := os.Remove(filepath.Join(dir, "c.json")); err != nil {
+					t.Fatalf("Failed to remove file: %v", err)
+				}
+			},
+			expected: []string{string(watch.Deleted) + " c"},
+		},
+	}
+
+	for _, step := range steps {
+		step.change()
+
+		if events := poll(); !reflect.DeepEqual(events, step.expected) {
+			t.Fatalf("%s: Expected %v, but got %v.", step.name, step.expected, events)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package input
+
+import (
+	"go.xrstf.de/stalk/pkg/diff"
+	"go.xrstf.de/stalk/pkg/watcher"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// Filter selects objects from an input the same way that objects are
+// selected when watching a cluster. Empty fields match all objects.
+type Filter struct {
+	// Kinds are kinds as given by the user, like "deploy" or "pods".
+	Kinds       []string
+	KindMatcher diff.KindMatcher
+
+	// Namespaces and Names can contain glob expressions.
+	Namespaces []string
+	Names      []string
+
+	Selector labels.Selector
+}
+
+func (f *Filter) Matches(obj *unstructured.Unstructured) bool {
+	return f.kindMatches(obj) &&
+		matchesAny(obj.GetNamespace(), f.Namespaces) &&
+		matchesAny(obj.GetName(), f.Names) &&
+		(f.Selector == nil || f.Selector.Matches(labels.Set(obj.GetLabels())))
+}
+
+func (f *Filter) kindMatches(obj *unstructured.Unstructured) bool {
+	if len(f.Kinds) == 0 {
+		return true
+	}
+
+	gvk := obj.GroupVersionKind()
+	for _, kind := range f.Kinds {
+		if f.KindMatcher.MatchesKind(kind, gvk) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func matchesAny(name string, patterns []string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+
+	for _, pattern := range patterns {
+		if watcher.NameMatches(name, pattern) {
+			return true
+		}
+	}
+
+	return false
+}
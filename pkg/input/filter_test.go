@@ -0,0 +1,84 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package input
+
+import (
+	"testing"
+
+	kubeutil "go.xrstf.de/stalk/pkg/kubernetes"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+func TestFilter(t *testing.T) {
+	deployment := &unstructured.Unstructured{}
+	deployment.SetAPIVersion("apps/v1")
+	deployment.SetKind("Deployment")
+	deployment.SetNamespace("team-a")
+	deployment.SetName("shop")
+	deployment.SetLabels(map[string]string{"app": "shop"})
+
+	testcases := []struct {
+		name     string
+		filter   Filter
+		expected bool
+	}{
+		{
+			name:     "empty filter",
+			filter:   Filter{},
+			expected: true,
+		},
+		{
+			name:     "matching kind",
+			filter:   Filter{Kinds: []string{"pods", "deploy"}},
+			expected: true,
+		},
+		{
+			name:     "other kind",
+			filter:   Filter{Kinds: []string{"statefulsets"}},
+			expected: false,
+		},
+		{
+			name:     "namespace glob",
+			filter:   Filter{Namespaces: []string{"team-*"}},
+			expected: true,
+		},
+		{
+			name:     "other namespace",
+			filter:   Filter{Namespaces: []string{"kube-system"}},
+			expected: false,
+		},
+		{
+			name:     "matching name",
+			filter:   Filter{Names: []string{"other", "sh*"}},
+			expected: true,
+		},
+		{
+			name:     "other name",
+			filter:   Filter{Names: []string{"other"}},
+			expected: false,
+		},
+		{
+			name:     "matching labels",
+			filter:   Filter{Selector: labels.SelectorFromSet(labels.Set{"app": "shop"})},
+			expected: true,
+		},
+		{
+			name:     "other labels",
+			filter:   Filter{Selector: labels.SelectorFromSet(labels.Set{"app": "other"})},
+			expected: false,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			testcase.filter.KindMatcher = kubeutil.NewKindMatcher(nil)
+
+			if matches := testcase.filter.Matches(deployment); matches != testcase.expected {
+				t.Errorf("Expected %v, but got %v.", testcase.expected, matches)
+			}
+		})
+	}
+}
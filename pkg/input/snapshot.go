@@ -0,0 +1,70 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package input
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// Snapshot keeps the complete set of objects of an input (like all items of
+// a List or all objects in a directory) and turns consecutive sets into
+// events: objects that appear are added, objects that disappear are deleted
+// and objects that changed are modified.
+type Snapshot struct {
+	objects map[string]*unstructured.Unstructured
+}
+
+func NewSnapshot() *Snapshot {
+	return &Snapshot{
+		objects: map[string]*unstructured.Unstructured{},
+	}
+}
+
+// Update replaces the snapshot with the given objects and returns the events
+// that lead from the previous to the new set of objects. Unchanged objects
+// do not produce events.
+func (s *Snapshot) Update(objects []*unstructured.Unstructured) []Event {
+	events := []Event{}
+	current := map[string]*unstructured.Unstructured{}
+
+	for _, obj := range objects {
+		key := ObjectKey(obj)
+		current[key] = obj
+
+		previous, exists := s.objects[key]
+		switch {
+		case !exists:
+			events = append(events, Event{Type: watch.Added, Object: obj})
+		case !reflect.DeepEqual(previous.Object, obj.Object):
+			events = append(events, Event{Type: watch.Modified, Object: obj})
+		}
+	}
+
+	deleted := []string{}
+	for key := range s.objects {
+		if _, exists := current[key]; !exists {
+			deleted = append(deleted, key)
+		}
+	}
+
+	sort.Strings(deleted)
+
+	for _, key := range deleted {
+		events = append(events, Event{Type: watch.Deleted, Object: s.objects[key]})
+	}
+
+	s.objects = current
+
+	return events
+}
+
+// ObjectKey identifies an object by its kind, namespace and name.
+func ObjectKey(obj *unstructured.Unstructured) string {
+	return fmt.Sprintf("%s/%s/%s", obj.GroupVersionKind().String(), obj.GetNamespace(), obj.GetName())
+}
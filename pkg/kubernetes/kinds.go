@@ -0,0 +1,129 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package kubernetes
+
+import (
+	"strings"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// shortNames are the short names of the most common built-in resources, so
+// that kinds can be matched even when no cluster is available to ask.
+var shortNames = map[string]string{
+	"cm":     "configmaps",
+	"cj":     "cronjobs",
+	"crd":    "customresourcedefinitions",
+	"crds":   "customresourcedefinitions",
+	"csr":    "certificatesigningrequests",
+	"deploy": "deployments",
+	"ds":     "daemonsets",
+	"ep":     "endpoints",
+	"ev":     "events",
+	"hpa":    "horizontalpodautoscalers",
+	"ing":    "ingresses",
+	"limits": "limitranges",
+	"netpol": "networkpolicies",
+	"no":     "nodes",
+	"ns":     "namespaces",
+	"pc":     "priorityclasses",
+	"pdb":    "poddisruptionbudgets",
+	"po":     "pods",
+	"pv":     "persistentvolumes",
+	"pvc":    "persistentvolumeclaims",
+	"quota":  "resourcequotas",
+	"rc":     "replicationcontrollers",
+	"rs":     "replicasets",
+	"sa":     "serviceaccounts",
+	"sc":     "storageclasses",
+	"sts":    "statefulsets",
+	"svc":    "services",
+}
+
+// KindMatcher decides whether a kind given by the user (like "deploy",
+// "deployments.apps" or "Deployment") matches the kind of an object. If a
+// resolver is available, kinds are resolved via the cluster's discovery
+// information, otherwise (or if resolving fails) a name-based heuristic is
+// used.
+type KindMatcher struct {
+	resolver *Resolver
+	resolved map[string]*schema.GroupKind
+	lock     *sync.Mutex
+}
+
+func NewKindMatcher(resolver *Resolver) *KindMatcher {
+	return &KindMatcher{
+		resolver: resolver,
+		resolved: map[string]*schema.GroupKind{},
+		lock:     &sync.Mutex{},
+	}
+}
+
+func (m *KindMatcher) MatchesKind(kind string, gvk schema.GroupVersionKind) bool {
+	if groupKind := m.resolve(kind); groupKind != nil {
+		return *groupKind == gvk.GroupKind()
+	}
+
+	return guessKindMatches(kind, gvk)
+}
+
+func (m *KindMatcher) resolve(kind string) *schema.GroupKind {
+	if m.resolver == nil {
+		return nil
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if groupKind, exists := m.resolved[kind]; exists {
+		return groupKind
+	}
+
+	var groupKind *schema.GroupKind
+
+	mapping, err := m.resolver.Resolve(strings.ToLower(kind))
+	if err == nil && mapping != nil {
+		gk := mapping.GroupVersionKind.GroupKind()
+		groupKind = &gk
+	}
+
+	m.resolved[kind] = groupKind
+
+	return groupKind
+}
+
+func guessKindMatches(kind string, gvk schema.GroupVersionKind) bool {
+	name, group, hasGroup := strings.Cut(strings.ToLower(kind), ".")
+
+	// "deployments.v1.apps" style
+	if hasGroup && strings.HasPrefix(group, gvk.Version+".") {
+		group = strings.TrimPrefix(group, gvk.Version+".")
+	}
+
+	if hasGroup && group != strings.ToLower(gvk.Group) && !(group == "core" && gvk.Group == "") {
+		return false
+	}
+
+	if fullName, ok := shortNames[name]; ok {
+		name = fullName
+	}
+
+	objectKind := strings.ToLower(gvk.Kind)
+
+	return name == objectKind || name == pluralize(objectKind)
+}
+
+func pluralize(kind string) string {
+	switch {
+	case strings.HasSuffix(kind, "s"), strings.HasSuffix(kind, "x"), strings.HasSuffix(kind, "ch"), strings.HasSuffix(kind, "sh"):
+		return kind + "es"
+
+	case strings.HasSuffix(kind, "y") && len(kind) > 1 && !strings.ContainsRune("aeiou", rune(kind[len(kind)-2])):
+		return kind[:len(kind)-1] + "ies"
+
+	default:
+		return kind + "s"
+	}
+}
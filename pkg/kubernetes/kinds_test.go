@@ -0,0 +1,47 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package kubernetes
+
+import (
+	"fmt"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestGuessKindMatches(t *testing.T) {
+	deployment := schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}
+	pod := schema.GroupVersionKind{Version: "v1", Kind: "Pod"}
+	ingress := schema.GroupVersionKind{Group: "networking.k8s.io", Version: "v1", Kind: "Ingress"}
+	policy := schema.GroupVersionKind{Group: "networking.k8s.io", Version: "v1", Kind: "NetworkPolicy"}
+
+	testcases := []struct {
+		kind     string
+		gvk      schema.GroupVersionKind
+		expected bool
+	}{
+		{kind: "Deployment", gvk: deployment, expected: true},
+		{kind: "deployments", gvk: deployment, expected: true},
+		{kind: "deploy", gvk: deployment, expected: true},
+		{kind: "deployments.apps", gvk: deployment, expected: true},
+		{kind: "deployments.v1.apps", gvk: deployment, expected: true},
+		{kind: "deployments.extensions", gvk: deployment, expected: false},
+		{kind: "pods", gvk: deployment, expected: false},
+		{kind: "pods", gvk: pod, expected: true},
+		{kind: "po", gvk: pod, expected: true},
+		{kind: "pods.core", gvk: pod, expected: true},
+		{kind: "ingresses", gvk: ingress, expected: true},
+		{kind: "ing", gvk: ingress, expected: true},
+		{kind: "networkpolicies", gvk: policy, expected: true},
+		{kind: "netpol", gvk: policy, expected: true},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(fmt.Sprintf("%s vs. %s", testcase.kind, testcase.gvk), func(t *testing.T) {
+			if matches := guessKindMatches(testcase.kind, testcase.gvk); matches != testcase.expected {
+				t.Errorf("Expected %v, but got %v.", testcase.expected, matches)
+			}
+		})
+	}
+}
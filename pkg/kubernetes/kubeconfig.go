@@ -0,0 +1,80 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package kubernetes
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/sirupsen/logrus"
+
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// NewResolverForContext creates a Resolver for the given kubeconfig context,
+// or the current context if none is given. An empty kubeconfig uses the
+// default loading rules.
+func NewResolverForContext(kubeconfig string, kubeContext string, log logrus.FieldLogger) (*Resolver, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = kubeconfig
+
+	overrides := &clientcmd.ConfigOverrides{
+		CurrentContext: kubeContext,
+	}
+
+	deferred := clientcmd.NewInteractiveDeferredLoadingClientConfig(rules, overrides, os.Stdin)
+	config, err := deferred.ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load kubeconfig: %w", err)
+	}
+
+	resolver, err := NewResolver(config, log)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create REST mapper: %w", err)
+	}
+
+	return resolver, nil
+}
+
+// CurrentCluster returns the name of the cluster that is referenced by the
+// given context (or the kubeconfig's current context).
+func CurrentCluster(kubeconfig string, kubeContext string) string {
+	config := loadKubeconfig(kubeconfig)
+	if config == nil {
+		return ""
+	}
+
+	if kubeContext == "" {
+		kubeContext = config.CurrentContext
+	}
+
+	if context, ok := config.Contexts[kubeContext]; ok {
+		return context.Cluster
+	}
+
+	return ""
+}
+
+// CurrentContext returns the name of the kubeconfig's current context.
+func CurrentContext(kubeconfig string) string {
+	config := loadKubeconfig(kubeconfig)
+	if config == nil {
+		return ""
+	}
+
+	return config.CurrentContext
+}
+
+func loadKubeconfig(kubeconfig string) *clientcmdapi.Config {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = kubeconfig
+
+	config, err := rules.Load()
+	if err != nil {
+		return nil
+	}
+
+	return config
+}
@@ -0,0 +1,223 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package kubernetes
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/openapi"
+)
+
+// openAPIDocument is the small subset of an OpenAPI v3 document that is
+// required to find list keys.
+type openAPIDocument struct {
+	Components struct {
+		Schemas map[string]*openAPISchema `json:"schemas"`
+	} `json:"components"`
+
+	// kinds contains the root schema of every kind in the document
+	kinds map[schema.GroupVersionKind]*openAPISchema
+}
+
+func parseOpenAPIDocument(data []byte) (*openAPIDocument, error) {
+	doc := &openAPIDocument{}
+	if err := json.Unmarshal(data, doc); err != nil {
+		return nil, err
+	}
+
+	doc.kinds = map[schema.GroupVersionKind]*openAPISchema{}
+	for _, s := range doc.Components.Schemas {
+		for _, gvk := range s.GVKs {
+			doc.kinds[schema.GroupVersionKind{Group: gvk.Group, Version: gvk.Version, Kind: gvk.Kind}] = s
+		}
+	}
+
+	return doc, nil
+}
+
+type openAPISchema struct {
+	Ref           string                    `json:"$ref"`
+	AllOf         []*openAPISchema          `json:"allOf"`
+	Properties    map[string]*openAPISchema `json:"properties"`
+	Items         *openAPISchema            `json:"items"`
+	ListMapKeys   []string                  `json:"x-kubernetes-list-map-keys"`
+	PatchMergeKey string                    `json:"x-kubernetes-patch-merge-key"`
+	GVKs          []struct {
+		Group   string `json:"group"`
+		Version string `json:"version"`
+		Kind    string `json:"kind"`
+	} `json:"x-kubernetes-group-version-kind"`
+}
+
+// ListKeys looks up the keys of lists (x-kubernetes-list-map-keys or
+// x-kubernetes-patch-merge-key) in the cluster's OpenAPI v3 schema. Schemas
+// are fetched lazily, once per API group version, so that a slow request
+// only delays the kinds of that group version.
+type ListKeys struct {
+	client openapi.Client
+	log    logrus.FieldLogger
+
+	paths     map[string]openapi.GroupVersion
+	pathsErr  error
+	pathsOnce sync.Once
+
+	documents map[schema.GroupVersion]*cachedDocument
+	lock      *sync.Mutex
+}
+
+type cachedDocument struct {
+	once sync.Once
+	doc  *openAPIDocument
+}
+
+func NewListKeys(resolver *Resolver, log logrus.FieldLogger) *ListKeys {
+	return &ListKeys{
+		client:    resolver.cache.OpenAPIV3(),
+		log:       log,
+		documents: map[schema.GroupVersion]*cachedDocument{},
+		lock:      &sync.Mutex{},
+	}
+}
+
+func (k *ListKeys) ListKeys(gvk schema.GroupVersionKind, path []string) []string {
+	doc := k.document(gvk.GroupVersion())
+	if doc == nil {
+		return nil
+	}
+
+	return findListKeys(doc, gvk, path)
+}
+
+func (k *ListKeys) document(gv schema.GroupVersion) *openAPIDocument {
+	k.lock.Lock()
+	cached, exists := k.documents[gv]
+	if !exists {
+		cached = &cachedDocument{}
+		k.documents[gv] = cached
+	}
+	k.lock.Unlock()
+
+	// failures are remembered as well, to not request the schema over and
+	// over again
+	cached.once.Do(func() {
+		doc, err := k.fetch(gv)
+		if err != nil {
+			k.log.Debugf("Failed to load OpenAPI schema for %s, falling back to well-known list keys: %v", gv, err)
+		}
+
+		cached.doc = doc
+	})
+
+	return cached.doc
+}
+
+func (k *ListKeys) fetch(gv schema.GroupVersion) (*openAPIDocument, error) {
+	k.pathsOnce.Do(func() {
+		k.paths, k.pathsErr = k.client.Paths()
+	})
+
+	if k.pathsErr != nil {
+		return nil, fmt.Errorf("failed to discover OpenAPI paths: %w", k.pathsErr)
+	}
+
+	path := "apis/" + gv.String()
+	if gv.Group == "" {
+		path = "api/" + gv.Version
+	}
+
+	groupVersion, ok := k.paths[path]
+	if !ok {
+		return nil, fmt.Errorf("no OpenAPI schema published for %s", path)
+	}
+
+	data, err := groupVersion.Schema("application/json")
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := parseOpenAPIDocument(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OpenAPI schema: %w", err)
+	}
+
+	return doc, nil
+}
+
+// findListKeys walks the schema of the given kind along the path and returns
+// the keys of the list at its end, if any.
+func findListKeys(doc *openAPIDocument, gvk schema.GroupVersionKind, path []string) []string {
+	current := doc.kinds[gvk]
+
+	for i, field := range path {
+		if current == nil {
+			return nil
+		}
+
+		// the path does not contain list indices, so descend into list items
+		if current.Items != nil {
+			current = resolveSchema(doc, current.Items)
+		}
+
+		if current == nil {
+			return nil
+		}
+
+		current = current.Properties[field]
+		if current == nil {
+			return nil
+		}
+
+		// keys can be defined next to a $ref, so check before resolving it
+		if i == len(path)-1 {
+			if keys := schemaListKeys(current); keys != nil {
+				return keys
+			}
+		}
+
+		current = resolveSchema(doc, current)
+	}
+
+	if current == nil {
+		return nil
+	}
+
+	return schemaListKeys(current)
+}
+
+func schemaListKeys(s *openAPISchema) []string {
+	if len(s.ListMapKeys) > 0 {
+		return s.ListMapKeys
+	}
+
+	if s.PatchMergeKey != "" {
+		return []string{s.PatchMergeKey}
+	}
+
+	return nil
+}
+
+// resolveSchema follows $refs, including those wrapped in an allOf (which
+// is how references with descriptions are expressed in OpenAPI v3).
+func resolveSchema(doc *openAPIDocument, s *openAPISchema) *openAPISchema {
+	for i := 0; s != nil && i < 10; i++ {
+		switch {
+		case s.Ref != "":
+			s = doc.Components.Schemas[strings.TrimPrefix(s.Ref, "#/components/schemas/")]
+
+		case len(s.AllOf) == 1 && s.Properties == nil && s.Items == nil:
+			s = s.AllOf[0]
+
+		default:
+			return s
+		}
+	}
+
+	return s
+}
@@ -0,0 +1,183 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package kubernetes
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/openapi"
+)
+
+const testOpenAPIDocument = `{
+  "components": {
+    "schemas": {
+      "io.k8s.api.apps.v1.Deployment": {
+        "properties": {
+          "spec": {"allOf": [{"$ref": "#/components/schemas/io.k8s.api.apps.v1.DeploymentSpec"}]},
+          "status": {"allOf": [{"$ref": "#/components/schemas/io.k8s.api.apps.v1.DeploymentStatus"}]}
+        },
+        "x-kubernetes-group-version-kind": [{"group": "apps", "kind": "Deployment", "version": "v1"}]
+      },
+      "io.k8s.api.apps.v1.DeploymentSpec": {
+        "properties": {
+          "template": {"allOf": [{"$ref": "#/components/schemas/io.k8s.api.core.v1.PodTemplateSpec"}]}
+        }
+      },
+      "io.k8s.api.apps.v1.DeploymentStatus": {
+        "properties": {
+          "conditions": {
+            "type": "array",
+            "items": {"allOf": [{"$ref": "#/components/schemas/io.k8s.api.apps.v1.DeploymentCondition"}]},
+            "x-kubernetes-list-map-keys": ["type"],
+            "x-kubernetes-list-type": "map"
+          }
+        }
+      },
+      "io.k8s.api.apps.v1.DeploymentCondition": {
+        "properties": {"type": {"type": "string"}}
+      },
+      "io.k8s.api.core.v1.PodTemplateSpec": {
+        "properties": {
+          "spec": {"allOf": [{"$ref": "#/components/schemas/io.k8s.api.core.v1.PodSpec"}]}
+        }
+      },
+      "io.k8s.api.core.v1.PodSpec": {
+        "properties": {
+          "containers": {
+            "type": "array",
+            "items": {"allOf": [{"$ref": "#/components/schemas/io.k8s.api.core.v1.Container"}]},
+            "x-kubernetes-patch-merge-key": "name"
+          }
+        }
+      },
+      "io.k8s.api.core.v1.Container": {
+        "properties": {
+          "ports": {
+            "type": "array",
+            "items": {"allOf": [{"$ref": "#/components/schemas/io.k8s.api.core.v1.ContainerPort"}]},
+            "x-kubernetes-list-map-keys": ["containerPort", "protocol"],
+            "x-kubernetes-list-type": "map"
+          },
+          "args": {"type": "array", "items": {"type": "string"}}
+        }
+      }
+    }
+  }
+}`
+
+func TestFindListKeys(t *testing.T) {
+	doc, err := parseOpenAPIDocument([]byte(testOpenAPIDocument))
+	if err != nil {
+		t.Fatalf("Failed to parse document: %v", err)
+	}
+
+	deployment := schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}
+
+	testcases := []struct {
+		gvk      schema.GroupVersionKind
+		path     string
+		expected []string
+	}{
+		{gvk: deployment, path: "status.conditions", expected: []string{"type"}},
+		{gvk: deployment, path: "spec.template.spec.containers", expected: []string{"name"}},
+		{gvk: deployment, path: "spec.template.spec.containers.ports", expected: []string{"containerPort", "protocol"}},
+		{gvk: deployment, path: "spec.template.spec.containers.args", expected: nil},
+		{gvk: deployment, path: "spec.unknown", expected: nil},
+		{gvk: schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "StatefulSet"}, path: "status.conditions", expected: nil},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.path, func(t *testing.T) {
+			keys := findListKeys(doc, testcase.gvk, strings.Split(testcase.path, "."))
+			if !reflect.DeepEqual(keys, testcase.expected) {
+				t.Errorf("Expected %v, but got %v.", testcase.expected, keys)
+			}
+		})
+	}
+}
+
+type fakeOpenAPIClient map[string]openapi.GroupVersion
+
+func (c fakeOpenAPIClient) Paths() (map[string]openapi.GroupVersion, error) {
+	return c, nil
+}
+
+type fakeGroupVersion struct {
+	schema   string
+	release  chan struct{}
+	requests atomic.Int32
+}
+
+func (gv *fakeGroupVersion) Schema(contentType string) ([]byte, error) {
+	gv.requests.Add(1)
+
+	if gv.release != nil {
+		<-gv.release
+	}
+
+	return []byte(gv.schema), nil
+}
+
+func (gv *fakeGroupVersion) ServerRelativeURL() string {
+	return ""
+}
+
+func TestListKeysFetchesConcurrently(t *testing.T) {
+	apps := &fakeGroupVersion{schema: testOpenAPIDocument, release: make(chan struct{})}
+	core := &fakeGroupVersion{schema: `{}`}
+
+	keys := &ListKeys{
+		client:    fakeOpenAPIClient{"apis/apps/v1": apps, "api/v1": core},
+		log:       logrus.New(),
+		documents: map[schema.GroupVersion]*cachedDocument{},
+		lock:      &sync.Mutex{},
+	}
+
+	deployment := schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}
+
+	var wg sync.WaitGroup
+	results := make([][]string, 3)
+
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = keys.ListKeys(deployment, []string{"status", "conditions"})
+		}()
+	}
+
+	// the slow apps/v1 schema must not block other group versions
+	done := make(chan struct{})
+	go func() {
+		keys.ListKeys(schema.GroupVersionKind{Version: "v1", Kind: "Pod"}, []string{"spec", "containers"})
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the core/v1 schema to be fetched while apps/v1 is still loading.")
+	}
+
+	close(apps.release)
+	wg.Wait()
+
+	for _, result := range results {
+		if !reflect.DeepEqual(result, []string{"type"}) {
+			t.Errorf("Expected [type], but got %v.", result)
+		}
+	}
+
+	if requests := apps.requests.Load(); requests != 1 {
+		t.Errorf("Expected the apps/v1 schema to be fetched once, but got %d requests.", requests)
+	}
+}
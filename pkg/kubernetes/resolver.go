@@ -129,6 +129,44 @@ func (r *Resolver) Resolve(resourceOrKindArg string) (*meta.RESTMapping, error)
 	return mapping, err
 }
 
+// ResolveKinds resolves a comma-separated list of resource kinds, like
+// "deploy,configmaps".
+func (r *Resolver) ResolveKinds(kinds string) ([]schema.GroupVersionKind, error) {
+	r.log.Debug("Resolving resource kinds...")
+
+	resolved := []schema.GroupVersionKind{}
+	seen := map[schema.GroupVersionKind]struct{}{}
+
+	for _, kind := range strings.Split(strings.ToLower(kinds), ",") {
+		r.log.Debugf("Resolving %s...", kind)
+
+		mapping, err := r.Resolve(kind)
+		if err != nil {
+			return nil, fmt.Errorf("unknown resource kind %q: %w", kind, err)
+		}
+
+		if mapping == nil {
+			return nil, fmt.Errorf("unknown resource kind %q", kind)
+		}
+
+		gvk := mapping.GroupVersionKind
+		if _, exists := seen[gvk]; exists {
+			continue
+		}
+
+		seen[gvk] = struct{}{}
+		resolved = append(resolved, gvk)
+
+		r.log.WithFields(logrus.Fields{
+			"group":   gvk.Group,
+			"version": gvk.Version,
+			"kind":    gvk.Kind,
+		}).Debug("Resolved")
+	}
+
+	return resolved, nil
+}
+
 // mappingFor is copied straight from kubectl:
 // https://github.com/kubernetes/kubernetes/blob/0b8d725f5a04178caf09cd802305c4b8370db65e/staging/src/k8s.io/cli-runtime/pkg/resource/builder.go
 func mappingFor(restMapper meta.RESTMapper, resourceOrKindArg string) (*meta.RESTMapping, error) {
@@ -128,3 +128,34 @@ func getSubPaths(paths []Path, head string) []Path {
 
 	return result
 }
+
+// TransformPath replaces all values at the given path with the result of the
+// transform function. Lists are traversed transparently, so "spec.containers.image"
+// matches the image of every container, and "*" matches any key.
+func TransformPath(value interface{}, path Path, transform func(interface{}) interface{}) interface{} {
+	if len(path) == 0 {
+		return transform(value)
+	}
+
+	switch asserted := value.(type) {
+	case map[string]interface{}:
+		head := path.Head()
+
+		for key, child := range asserted {
+			if head == "*" || key == head {
+				asserted[key] = TransformPath(child, path.Tail(), transform)
+			}
+		}
+
+		return asserted
+
+	case []interface{}:
+		for i, item := range asserted {
+			asserted[i] = TransformPath(item, path, transform)
+		}
+
+		return asserted
+	}
+
+	return value
+}
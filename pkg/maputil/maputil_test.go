@@ -157,3 +157,71 @@ func TestPruneObject(t *testing.T) {
 		})
 	}
 }
+
+func TestTransformPath(t *testing.T) {
+	testcases := []struct {
+		input    string
+		path     string
+		expected string
+	}{
+		{
+			input:    `{"foo":"bar"}`,
+			path:     `foo`,
+			expected: `{"foo":"x"}`,
+		},
+		{
+			input:    `{"foo":"bar"}`,
+			path:     `bar`,
+			expected: `{"foo":"bar"}`,
+		},
+		{
+			input:    `{"foo":{"bar":12,"extra":"yes"}}`,
+			path:     `foo.bar`,
+			expected: `{"foo":{"bar":"x","extra":"yes"}}`,
+		},
+		{
+			input:    `{"foo":{"bar":12}}`,
+			path:     `foo`,
+			expected: `{"foo":"x"}`,
+		},
+		{
+			input:    `{"foo":[{"bar":1},{"bar":2,"extra":"yes"},"text"]}`,
+			path:     `foo.bar`,
+			expected: `{"foo":[{"bar":"x"},{"bar":"x","extra":"yes"},"text"]}`,
+		},
+		{
+			input:    `{"foo":{"a":{"bar":1},"b":{"bar":2}}}`,
+			path:     `foo.*.bar`,
+			expected: `{"foo":{"a":{"bar":"x"},"b":{"bar":"x"}}}`,
+		},
+		{
+			input:    `{"foo":"bar"}`,
+			path:     `foo.bar`,
+			expected: `{"foo":"bar"}`,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(fmt.Sprintf("%s against %s", testcase.path, testcase.input), func(t *testing.T) {
+			var input map[string]interface{}
+			if err := json.Unmarshal([]byte(testcase.input), &input); err != nil {
+				t.Fatalf("invalid testcase: %v", err)
+			}
+
+			p, err := ParsePath(testcase.path)
+			if err != nil {
+				t.Fatalf("invalid path: %v", err)
+			}
+
+			output := TransformPath(input, p, func(interface{}) interface{} {
+				return "x"
+			})
+
+			outputEncoded, _ := json.Marshal(output)
+
+			if string(outputEncoded) != testcase.expected {
+				t.Errorf("Expected %q, but got %q.", testcase.expected, string(outputEncoded))
+			}
+		})
+	}
+}
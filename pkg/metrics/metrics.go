@@ -0,0 +1,117 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/sirupsen/logrus"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const namespace = "stalk"
+
+var gvkLabels = []string{"group", "version", "kind"}
+
+var (
+	EventsReceived = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "events_received_total",
+		Help:      "Number of events received, per resource kind and event type",
+	}, append(gvkLabels, "event"))
+
+	DiffsPrinted = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "diffs_printed_total",
+		Help:      "Number of diffs that have been printed",
+	}, gvkLabels)
+
+	DiffsSuppressed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "diffs_suppressed_total",
+		Help:      "Number of diffs that have not been printed because they were empty after filtering or made by other field managers",
+	}, gvkLabels)
+
+	WatchRestarts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "watch_restarts_total",
+		Help:      "Number of times a watch had to be restarted",
+	}, gvkLabels)
+
+	WatchErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "watch_errors_total",
+		Help:      "Number of errors that occurred while starting or consuming watches",
+	}, gvkLabels)
+
+	CacheSize = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "cache_objects",
+		Help:      "Number of objects currently kept in the cache",
+	})
+
+	PreprocessDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "preprocess_duration_seconds",
+		Help:      "Time spent filtering and encoding objects before diffing",
+		Buckets:   prometheus.ExponentialBuckets(0.0001, 4, 8),
+	})
+
+	DiffDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "diff_duration_seconds",
+		Help:      "Time spent calculating diffs",
+		Buckets:   prometheus.ExponentialBuckets(0.0001, 4, 8),
+	})
+)
+
+var registry = prometheus.NewRegistry()
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		EventsReceived,
+		DiffsPrinted,
+		DiffsSuppressed,
+		WatchRestarts,
+		WatchErrors,
+		CacheSize,
+		PreprocessDuration,
+		DiffDuration,
+	)
+}
+
+// GVK returns the label values for a GroupVersionKind, suitable for all
+// metric vectors that are partitioned by resource kind.
+func GVK(gvk schema.GroupVersionKind) []string {
+	return []string{gvk.Group, gvk.Version, gvk.Kind}
+}
+
+// Serve starts an HTTP server in the background that exposes all metrics
+// on /metrics.
+func Serve(addr string, log logrus.FieldLogger) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		log.Infof("Serving metrics on %s...", addr)
+
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Failed to serve metrics: %v", err)
+		}
+	}()
+}
@@ -0,0 +1,57 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package watcher
+
+import (
+	"context"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+)
+
+// List returns all resources that match the label selector and the
+// watcher's namespaces and names.
+func (w *Watcher) List(ctx context.Context, client dynamic.ResourceInterface, labelSelector string) ([]*unstructured.Unstructured, error) {
+	list, err := client.List(ctx, metav1.ListOptions{
+		LabelSelector: labelSelector,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	objects := []*unstructured.Unstructured{}
+	for i := range list.Items {
+		if w.Matches(&list.Items[i]) {
+			objects = append(objects, &list.Items[i])
+		}
+	}
+
+	return objects, nil
+}
+
+// RunClient is like Run, but lists and watches the resources using the
+// given dynamic client.
+func (w *Watcher) RunClient(ctx context.Context, gvk schema.GroupVersionKind, client dynamic.ResourceInterface, labelSelector string) error {
+	list := func(ctx context.Context) ([]unstructured.Unstructured, string, error) {
+		objects, err := client.List(ctx, metav1.ListOptions{
+			LabelSelector: labelSelector,
+		})
+		if err != nil {
+			return nil, "", err
+		}
+
+		return objects.Items, objects.GetResourceVersion(), nil
+	}
+
+	return w.Run(ctx, gvk, list, func(ctx context.Context, resourceVersion string) (watch.Interface, error) {
+		return client.Watch(ctx, metav1.ListOptions{
+			LabelSelector:       labelSelector,
+			ResourceVersion:     resourceVersion,
+			AllowWatchBookmarks: true,
+		})
+	})
+}
@@ -7,40 +7,283 @@ import (
 	"context"
 	"path/filepath"
 	"strings"
+	"time"
 
-	"go.xrstf.de/stalk/pkg/diff"
+	"github.com/sirupsen/logrus"
 
+	"go.xrstf.de/stalk/pkg/metrics"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/watch"
 )
 
+const maxRestartBackoff = 30 * time.Second
+
+// restartBackoff is the initial delay before restarting a failed watch.
+var restartBackoff = time.Second
+
+// WatchFunc starts a new watch. An empty resource version starts the watch
+// with synthetic ADDED events for all currently existing resources.
+type WatchFunc func(ctx context.Context, resourceVersion string) (watch.Interface, error)
+
+// ListFunc lists all current resources and returns them together with the
+// resource version of the list.
+type ListFunc func(ctx context.Context) ([]unstructured.Unstructured, string, error)
+
+// Printer handles the events of a Watcher, usually a *diff.Printer.
+type Printer interface {
+	Print(obj *unstructured.Unstructured, event watch.EventType)
+}
+
 type Watcher struct {
-	printer       *diff.Printer
+	printer       Printer
+	log           logrus.FieldLogger
 	namespaces    []string
 	resourceNames []string
 }
 
-func NewWatcher(printer *diff.Printer, namespaces, resourceNames []string) *Watcher {
+func NewWatcher(printer Printer, log logrus.FieldLogger, namespaces, resourceNames []string) *Watcher {
 	return &Watcher{
 		printer:       printer,
+		log:           log,
 		namespaces:    namespaces,
 		resourceNames: resourceNames,
 	}
 }
 
-func (w *Watcher) Watch(ctx context.Context, wi watch.Interface) {
-	for event := range wi.ResultChan() {
-		obj, ok := event.Object.(*unstructured.Unstructured)
-		if !ok {
+// Run watches resources until the context is cancelled. Watches that end
+// (e.g. because the apiserver closed the connection) are restarted from the
+// last seen resource version. If that version has expired, all resources are
+// listed and compared to the known ones, so that changes and deletions that
+// happened in the meantime are not lost. An error is only returned if the
+// very first watch cannot be started.
+func (w *Watcher) Run(ctx context.Context, gvk schema.GroupVersionKind, list ListFunc, startWatch WatchFunc) error {
+	log := w.log.WithField("kind", gvk.Kind)
+	gvkLabels := metrics.GVK(gvk)
+
+	// known contains all objects that have been passed to the printer and
+	// still exist, keyed by namespace and name
+	known := map[string]*unstructured.Unstructured{}
+
+	resourceVersion := ""
+	relist := false
+	started := false
+	backoff := restartBackoff
+
+	// retry waits before the next attempt, with an increasing delay
+	retry := func() bool {
+		if !sleep(ctx, backoff) {
+			return false
+		}
+
+		backoff = min(2*backoff, maxRestartBackoff)
+
+		return true
+	}
+
+	for {
+		if relist {
+			version, err := w.relist(ctx, list, known)
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil
+				}
+
+				metrics.WatchErrors.WithLabelValues(gvkLabels...).Inc()
+				log.Errorf("Failed to list resources, retrying in %v: %v", backoff, err)
+
+				if !retry() {
+					return nil
+				}
+
+				continue
+			}
+
+			resourceVersion = version
+			relist = false
+		}
+
+		wi, err := startWatch(ctx, resourceVersion)
+		if err != nil {
+			if !started {
+				return err
+			}
+
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			metrics.WatchErrors.WithLabelValues(gvkLabels...).Inc()
+			log.Errorf("Failed to start watch, retrying in %v: %v", backoff, err)
+
+			if !retry() {
+				return nil
+			}
+
 			continue
 		}
 
-		if w.resourceNameMatches(obj) && w.resourceNamespaceMatches(obj) {
-			w.printer.Print(obj, event.Type)
+		started = true
+
+		lastVersion, err := w.watch(ctx, wi, known)
+		wi.Stop()
+
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		switch {
+		case apierrors.IsResourceExpired(err) || apierrors.IsGone(err):
+			log.Debug("Resource version expired, listing all resources.")
+			resourceVersion = ""
+			relist = true
+
+		case err != nil:
+			metrics.WatchErrors.WithLabelValues(gvkLabels...).Inc()
+			log.Warnf("Watch failed: %v", err)
+		}
+
+		if lastVersion != "" && !relist {
+			resourceVersion = lastVersion
+		}
+
+		metrics.WatchRestarts.WithLabelValues(gvkLabels...).Inc()
+
+		// watches that failed or ended without delivering anything are not
+		// restarted immediately, so that a broken apiserver is not hammered
+		if err != nil || lastVersion == "" {
+			log.Debugf("Restarting watch in %v...", backoff)
+
+			if !retry() {
+				return nil
+			}
+		} else {
+			backoff = restartBackoff
+			log.Debug("Restarting watch...")
 		}
 	}
 }
 
+// watch consumes the watch until it ends and returns the last seen resource
+// version.
+func (w *Watcher) watch(ctx context.Context, wi watch.Interface, known map[string]*unstructured.Unstructured) (string, error) {
+	lastVersion := ""
+
+	for {
+		select {
+		case <-ctx.Done():
+			return lastVersion, nil
+
+		case event, ok := <-wi.ResultChan():
+			if !ok {
+				return lastVersion, nil
+			}
+
+			if event.Type == watch.Error {
+				return lastVersion, apierrors.FromObject(event.Object)
+			}
+
+			obj, ok := event.Object.(*unstructured.Unstructured)
+			if !ok {
+				continue
+			}
+
+			lastVersion = obj.GetResourceVersion()
+
+			if event.Type == watch.Bookmark {
+				continue
+			}
+
+			if w.Matches(obj) {
+				w.print(obj, event.Type, known)
+			}
+		}
+	}
+}
+
+// relist lists all resources and prints the differences to the known
+// resources: new resources are added, changed ones are modified and the ones
+// that are gone are deleted. It returns the resource version to continue
+// watching from.
+func (w *Watcher) relist(ctx context.Context, list ListFunc, known map[string]*unstructured.Unstructured) (string, error) {
+	items, resourceVersion, err := list(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	current := map[string]struct{}{}
+
+	for i := range items {
+		obj := &items[i]
+		if !w.Matches(obj) {
+			continue
+		}
+
+		key := objectKey(obj)
+		current[key] = struct{}{}
+
+		existing, exists := known[key]
+		switch {
+		case !exists:
+			w.print(obj, watch.Added, known)
+		case existing.GetResourceVersion() != obj.GetResourceVersion():
+			w.print(obj, watch.Modified, known)
+		}
+	}
+
+	for key, obj := range known {
+		if _, exists := current[key]; !exists {
+			w.print(obj, watch.Deleted, known)
+		}
+	}
+
+	return resourceVersion, nil
+}
+
+// print passes the event to the printer and keeps track of the known
+// objects. Watches that start without a resource version replay all existing
+// objects as ADDED events; these are only shown if the object changed.
+func (w *Watcher) print(obj *unstructured.Unstructured, event watch.EventType, known map[string]*unstructured.Unstructured) {
+	key := objectKey(obj)
+
+	if event == watch.Deleted {
+		delete(known, key)
+	} else {
+		if existing, exists := known[key]; exists && event == watch.Added {
+			if existing.GetResourceVersion() == obj.GetResourceVersion() {
+				return
+			}
+
+			event = watch.Modified
+		}
+
+		known[key] = obj
+	}
+
+	w.printer.Print(obj, event)
+}
+
+func objectKey(obj *unstructured.Unstructured) string {
+	return obj.GetNamespace() + "/" + obj.GetName()
+}
+
+func sleep(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
+
+// Matches returns true if the object matches the configured namespaces and
+// resource names.
+func (w *Watcher) Matches(obj *unstructured.Unstructured) bool {
+	return w.resourceNameMatches(obj) && w.resourceNamespaceMatches(obj)
+}
+
 func (w *Watcher) resourceNameMatches(obj *unstructured.Unstructured) bool {
 	// no names given, so all resources match
 	if len(w.resourceNames) == 0 {
@@ -48,7 +291,7 @@ func (w *Watcher) resourceNameMatches(obj *unstructured.Unstructured) bool {
 	}
 
 	for _, wantedName := range w.resourceNames {
-		if nameMatches(obj.GetName(), wantedName) {
+		if NameMatches(obj.GetName(), wantedName) {
 			return true
 		}
 	}
@@ -63,7 +306,7 @@ func (w *Watcher) resourceNamespaceMatches(obj *unstructured.Unstructured) bool
 	}
 
 	for _, wantedNamespace := range w.namespaces {
-		if nameMatches(obj.GetNamespace(), wantedNamespace) {
+		if NameMatches(obj.GetNamespace(), wantedNamespace) {
 			return true
 		}
 	}
@@ -71,7 +314,9 @@ func (w *Watcher) resourceNamespaceMatches(obj *unstructured.Unstructured) bool
 	return false
 }
 
-func nameMatches(name string, pattern string) bool {
+// NameMatches checks if the name matches the pattern, which can contain
+// glob expressions like "team-*".
+func NameMatches(name string, pattern string) bool {
 	if strings.Contains(pattern, "*") {
 		matched, _ := filepath.Match(pattern, name)
 		return matched
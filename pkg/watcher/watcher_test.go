@@ -0,0 +1,317 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package watcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sirupsen/logrus"
+
+	"go.xrstf.de/stalk/pkg/metrics"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+type recordingPrinter struct {
+	events []string
+	done   func(events []string)
+}
+
+func (p *recordingPrinter) Print(obj *unstructured.Unstructured, event watch.EventType) {
+	p.events = append(p.events, fmt.Sprintf("%s %s@%s", event, obj.GetName(), obj.GetResourceVersion()))
+	p.done(p.events)
+}
+
+func testObject(name, resourceVersion string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion("v1")
+	obj.SetKind("ConfigMap")
+	obj.SetNamespace("default")
+	obj.SetName(name)
+	obj.SetResourceVersion(resourceVersion)
+
+	return obj
+}
+
+func TestWatcherRelist(t *testing.T) {
+	restartBackoff = time.Millisecond
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	expected := []string{
+		"ADDED a@1",
+		"ADDED b@1",
+		// the watch expired, so everything is listed again
+		"MODIFIED a@2",
+		"ADDED c@3",
+		"DELETED b@1",
+		// the watch is resumed from the list's resource version and new
+		// objects are still shown as added
+		"ADDED d@5",
+	}
+
+	printer := &recordingPrinter{
+		done: func(events []string) {
+			if len(events) == len(expected) {
+				cancel()
+			}
+		},
+	}
+
+	watches := []struct {
+		expectedVersion string
+		events          []watch.Event
+	}{
+		{
+			expectedVersion: "",
+			events: []watch.Event{
+				{Type: watch.Added, Object: testObject("a", "1")},
+				{Type: watch.Added, Object: testObject("b", "1")},
+				{Type: watch.Error, Object: &apierrors.NewResourceExpired("too old").ErrStatus},
+			},
+		},
+		{
+			expectedVersion: "4",
+			events: []watch.Event{
+				// replayed objects are only shown if they changed
+				{Type: watch.Added, Object: testObject("c", "3")},
+				{Type: watch.Added, Object: testObject("d", "5")},
+			},
+		},
+	}
+
+	lists := 0
+	list := func(ctx context.Context) ([]unstructured.Unstructured, string, error) {
+		// the first attempt fails and has to be retried
+		lists++
+		if lists == 1 {
+			return nil, "", errors.New("failed")
+		}
+
+		return []unstructured.Unstructured{*testObject("a", "2"), *testObject("c", "3")}, "4", nil
+	}
+
+	startWatch := func(ctx context.Context, resourceVersion string) (watch.Interface, error) {
+		if len(watches) == 0 {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+
+		current := watches[0]
+		watches = watches[1:]
+
+		if resourceVersion != current.expectedVersion {
+			t.Errorf("Expected watch to start at %q, but got %q.", current.expectedVersion, resourceVersion)
+		}
+
+		fake := watch.NewFakeWithChanSize(len(current.events), false)
+		for _, event := range current.events {
+			fake.Action(event.Type, event.Object)
+		}
+
+		fake.Stop()
+
+		return fake, nil
+	}
+
+	errorCounter := metrics.WatchErrors.WithLabelValues("", "v1", "ConfigMap")
+	previousErrors := testutil.ToFloat64(errorCounter)
+
+	w := NewWatcher(printer, logrus.New(), nil, nil)
+	if err := w.Run(ctx, schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, list, startWatch); err != nil {
+		t.Fatalf("Failed to run watcher: %v", err)
+	}
+
+	if !reflect.DeepEqual(expected, printer.events) {
+		t.Errorf("Expected %v, but got %v.", expected, printer.events)
+	}
+
+	// the failed list is an error, the expired watch is not
+	if watchErrors := testutil.ToFloat64(errorCounter) - previousErrors; watchErrors != 1 {
+		t.Errorf("Expected 1 watch error, but got %v.", watchErrors)
+	}
+}
+
+// watchStep is either a watch that delivers the given events and then ends,
+// or a failure to start the watch.
+type watchStep struct {
+	expectedVersion string
+	events          []watch.Event
+	err             error
+}
+
+func TestWatcherRestart(t *testing.T) {
+	restartBackoff = time.Millisecond
+
+	testcases := []struct {
+		name            string
+		resourceNames   []string
+		steps           []watchStep
+		expected        []string
+		expectedErrors  float64
+		minimumRestarts float64
+	}{
+		{
+			name: "ended watches resume from the last seen version",
+			steps: []watchStep{
+				{
+					events: []watch.Event{
+						{Type: watch.Added, Object: testObject("a", "1")},
+						{Type: watch.Modified, Object: testObject("a", "2")},
+					},
+				},
+				{
+					expectedVersion: "2",
+					events: []watch.Event{
+						{Type: watch.Deleted, Object: testObject("a", "3")},
+					},
+				},
+			},
+			expected:        []string{"ADDED a@1", "MODIFIED a@2", "DELETED a@3"},
+			minimumRestarts: 1,
+		},
+		{
+			name: "bookmarks advance the version, but are not printed",
+			steps: []watchStep{
+				{
+					events: []watch.Event{
+						{Type: watch.Added, Object: testObject("a", "1")},
+						{Type: watch.Bookmark, Object: testObject("", "5")},
+					},
+				},
+				{
+					expectedVersion: "5",
+				},
+			},
+			expected:        []string{"ADDED a@1"},
+			minimumRestarts: 1,
+		},
+		{
+			name: "failing watches are restarted from the last seen version",
+			steps: []watchStep{
+				{
+					events: []watch.Event{
+						{Type: watch.Added, Object: testObject("a", "1")},
+						{Type: watch.Error, Object: &apierrors.NewInternalError(errors.New("boom")).ErrStatus},
+					},
+				},
+				{
+					expectedVersion: "1",
+					err:             errors.New("connection refused"),
+				},
+				{
+					expectedVersion: "1",
+					events: []watch.Event{
+						{Type: watch.Modified, Object: testObject("a", "2")},
+					},
+				},
+			},
+			expected:        []string{"ADDED a@1", "MODIFIED a@2"},
+			expectedErrors:  2,
+			minimumRestarts: 1,
+		},
+		{
+			name:          "only matching objects are printed",
+			resourceNames: []string{"a*"},
+			steps: []watchStep{
+				{
+					events: []watch.Event{
+						{Type: watch.Added, Object: testObject("a1", "1")},
+						{Type: watch.Added, Object: testObject("b", "2")},
+						{Type: watch.Added, Object: testObject("a2", "3")},
+					},
+				},
+			},
+			expected: []string{"ADDED a1@1", "ADDED a2@3"},
+		},
+	}
+
+	for i, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			steps := testcase.steps
+			startWatch := func(ctx context.Context, resourceVersion string) (watch.Interface, error) {
+				// stop once all steps have been played
+				if len(steps) == 0 {
+					cancel()
+					return nil, ctx.Err()
+				}
+
+				current := steps[0]
+				steps = steps[1:]
+
+				if resourceVersion != current.expectedVersion {
+					t.Errorf("Expected watch to start at %q, but got %q.", current.expectedVersion, resourceVersion)
+				}
+
+				if current.err != nil {
+					return nil, current.err
+				}
+
+				fake := watch.NewFakeWithChanSize(len(current.events), false)
+				for _, event := range current.events {
+					fake.Action(event.Type, event.Object)
+				}
+
+				fake.Stop()
+
+				return fake, nil
+			}
+
+			list := func(ctx context.Context) ([]unstructured.Unstructured, string, error) {
+				t.Error("Expected no list to be necessary.")
+				return nil, "", errors.New("unexpected list")
+			}
+
+			// metrics are global, so every testcase uses its own kind
+			gvk := schema.GroupVersionKind{Version: "v1", Kind: fmt.Sprintf("Restart%d", i)}
+			errorCounter := metrics.WatchErrors.WithLabelValues(metrics.GVK(gvk)...)
+			restartCounter := metrics.WatchRestarts.WithLabelValues(metrics.GVK(gvk)...)
+			previousErrors := testutil.ToFloat64(errorCounter)
+			previousRestarts := testutil.ToFloat64(restartCounter)
+
+			printer := &recordingPrinter{done: func([]string) {}}
+
+			w := NewWatcher(printer, logrus.New(), nil, testcase.resourceNames)
+			if err := w.Run(ctx, gvk, list, startWatch); err != nil {
+				t.Fatalf("Failed to run watcher: %v", err)
+			}
+
+			if !reflect.DeepEqual(testcase.expected, printer.events) {
+				t.Errorf("Expected %v, but got %v.", testcase.expected, printer.events)
+			}
+
+			if watchErrors := testutil.ToFloat64(errorCounter) - previousErrors; watchErrors != testcase.expectedErrors {
+				t.Errorf("Expected %v watch errors, but got %v.", testcase.expectedErrors, watchErrors)
+			}
+
+			if restarts := testutil.ToFloat64(restartCounter) - previousRestarts; restarts < testcase.minimumRestarts {
+				t.Errorf("Expected at least %v watch restarts, but got %v.", testcase.minimumRestarts, restarts)
+			}
+		})
+	}
+}
+
+func TestWatcherFirstWatchFails(t *testing.T) {
+	startWatch := func(ctx context.Context, resourceVersion string) (watch.Interface, error) {
+		return nil, errors.New("forbidden")
+	}
+
+	w := NewWatcher(&recordingPrinter{}, logrus.New(), nil, nil)
+	if err := w.Run(context.Background(), schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, nil, startWatch); err == nil {
+		t.Error("Expected an error if the first watch cannot be started.")
+	}
+}
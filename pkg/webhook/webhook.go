@@ -0,0 +1,321 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"go.xrstf.de/stalk/pkg/diff"
+)
+
+// SignatureHeader contains the hex-encoded HMAC-SHA256 of the request body,
+// if a secret has been configured.
+const SignatureHeader = "X-Stalk-Signature"
+
+// DefaultShutdownTimeout is the default for Options.ShutdownTimeout.
+const DefaultShutdownTimeout = 30 * time.Second
+
+type Options struct {
+	URLs []string
+	// Template is an optional Go template that is used to render the request
+	// body. If empty, the event is sent as JSON.
+	Template string
+	// ContentType is sent as the Content-Type header, "application/json" by
+	// default.
+	ContentType string
+	Secret      string
+	QueueSize   int
+	Retries     int
+	Backoff     time.Duration
+	Timeout     time.Duration
+	// ShutdownTimeout limits how long Close waits for queued events to be
+	// delivered before pending retries are given up, DefaultShutdownTimeout
+	// by default.
+	ShutdownTimeout time.Duration
+
+	compiledTemplate *template.Template
+}
+
+func (o *Options) Validate() error {
+	if len(o.URLs) == 0 {
+		return errors.New("no URL given")
+	}
+
+	for _, u := range o.URLs {
+		parsed, err := url.Parse(u)
+		if err != nil {
+			return fmt.Errorf("invalid URL %q: %w", u, err)
+		}
+
+		if parsed.Scheme != "http" && parsed.Scheme != "https" {
+			return fmt.Errorf("invalid URL %q: scheme must be http or https", u)
+		}
+	}
+
+	if o.Template != "" {
+		tpl, err := template.New("webhook").Funcs(templateFuncs).Parse(o.Template)
+		if err != nil {
+			return fmt.Errorf("invalid template: %w", err)
+		}
+
+		o.compiledTemplate = tpl
+	}
+
+	if o.QueueSize < 1 {
+		return errors.New("queue size must be at least 1")
+	}
+
+	if o.Retries < 0 {
+		return errors.New("retries cannot be negative")
+	}
+
+	if o.Backoff < 0 {
+		return errors.New("backoff cannot be negative")
+	}
+
+	if o.Timeout < 0 {
+		return errors.New("timeout cannot be negative")
+	}
+
+	if o.ShutdownTimeout < 0 {
+		return errors.New("shutdown timeout cannot be negative")
+	}
+
+	return nil
+}
+
+var templateFuncs = template.FuncMap{
+	"toJson": func(v interface{}) (string, error) {
+		encoded, err := json.Marshal(v)
+		return string(encoded), err
+	},
+}
+
+// Sink is a diff.Sink that POSTs every event to a set of HTTP endpoints.
+// Each endpoint has its own bounded queue, so a slow endpoint does not delay
+// the others. When a queue is full, new events for it are dropped.
+type Sink struct {
+	opt       *Options
+	log       logrus.FieldLogger
+	client    *http.Client
+	endpoints []*endpoint
+	lock      *sync.Mutex
+	closed    bool
+	// stop is closed once the shutdown timeout has passed, so that pending
+	// retries are given up
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+type endpoint struct {
+	url   string
+	queue chan *diff.Event
+}
+
+var _ diff.Sink = &Sink{}
+
+func NewSink(opt *Options, log logrus.FieldLogger) (*Sink, error) {
+	if err := opt.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid options: %w", err)
+	}
+
+	s := &Sink{
+		opt: opt,
+		log: log,
+		client: &http.Client{
+			Timeout: opt.Timeout,
+		},
+		lock: &sync.Mutex{},
+		stop: make(chan struct{}),
+	}
+
+	for _, u := range opt.URLs {
+		ep := &endpoint{
+			url:   u,
+			queue: make(chan *diff.Event, opt.QueueSize),
+		}
+
+		s.endpoints = append(s.endpoints, ep)
+		s.wg.Add(1)
+
+		go func() {
+			defer s.wg.Done()
+			s.work(ep)
+		}()
+	}
+
+	return s, nil
+}
+
+func (s *Sink) Send(event *diff.Event) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.closed {
+		return
+	}
+
+	for _, ep := range s.endpoints {
+		select {
+		case ep.queue <- event:
+		default:
+			s.log.WithField("url", ep.url).Warn("Webhook queue is full, dropping event.")
+		}
+	}
+}
+
+// Close waits for all queued events to be delivered. Retries that are still
+// pending after the shutdown timeout are given up.
+func (s *Sink) Close() {
+	var deadline *time.Timer
+
+	s.lock.Lock()
+	if !s.closed {
+		s.closed = true
+
+		for _, ep := range s.endpoints {
+			close(ep.queue)
+		}
+
+		timeout := s.opt.ShutdownTimeout
+		if timeout == 0 {
+			timeout = DefaultShutdownTimeout
+		}
+
+		deadline = time.AfterFunc(timeout, func() { close(s.stop) })
+	}
+	s.lock.Unlock()
+
+	s.wg.Wait()
+
+	if deadline != nil {
+		deadline.Stop()
+	}
+}
+
+func (s *Sink) work(ep *endpoint) {
+	log := s.log.WithField("url", ep.url)
+
+	for event := range ep.queue {
+		body, err := s.render(event)
+		if err != nil {
+			log.Errorf("Failed to render webhook payload: %v", err)
+			continue
+		}
+
+		if err := s.deliver(ep.url, body); err != nil {
+			log.Errorf("Failed to deliver webhook: %v", err)
+		}
+	}
+}
+
+func (s *Sink) render(event *diff.Event) ([]byte, error) {
+	if s.opt.compiledTemplate == nil {
+		return json.Marshal(event)
+	}
+
+	var buf bytes.Buffer
+	if err := s.opt.compiledTemplate.Execute(&buf, event); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (s *Sink) deliver(url string, body []byte) error {
+	backoff := s.opt.Backoff
+
+	var err error
+	for attempt := 0; attempt <= s.opt.Retries; attempt++ {
+		if attempt > 0 {
+			s.log.WithField("url", url).Debugf("Webhook delivery failed (%v), retrying in %v...", err, backoff)
+
+			if !s.wait(backoff) {
+				return fmt.Errorf("giving up after %d attempts during shutdown: %w", attempt, err)
+			}
+
+			backoff *= 2
+		}
+
+		var retryable bool
+		retryable, err = s.post(url, body)
+		if err == nil || !retryable {
+			return err
+		}
+	}
+
+	return fmt.Errorf("giving up after %d attempts: %w", s.opt.Retries+1, err)
+}
+
+// wait waits for the given duration and returns false if the Sink has been
+// closed in the meantime.
+func (s *Sink) wait(d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-s.stop:
+		return false
+	}
+}
+
+func (s *Sink) post(url string, body []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+
+	contentType := s.opt.ContentType
+	if contentType == "" {
+		contentType = "application/json"
+	}
+
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("User-Agent", "stalk")
+
+	if s.opt.Secret != "" {
+		req.Header.Set(SignatureHeader, "sha256="+Sign(body, s.opt.Secret))
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+
+	// drain the body to allow connections to be re-used
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+
+	retryable := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+
+	return retryable, fmt.Errorf("server responded with %s", resp.Status)
+}
+
+// Sign returns the hex-encoded HMAC-SHA256 of the body.
+func Sign(body []byte, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,221 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package webhook
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"go.xrstf.de/stalk/pkg/diff"
+
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+type request struct {
+	body        []byte
+	signature   string
+	contentType string
+}
+
+func startServer(t *testing.T, failures int) (*httptest.Server, func() []request) {
+	var (
+		lock     sync.Mutex
+		requests []request
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		lock.Lock()
+		defer lock.Unlock()
+
+		if failures > 0 {
+			failures--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		requests = append(requests, request{
+			body:        body,
+			signature:   r.Header.Get(SignatureHeader),
+			contentType: r.Header.Get("Content-Type"),
+		})
+	}))
+	t.Cleanup(server.Close)
+
+	return server, func() []request {
+		lock.Lock()
+		defer lock.Unlock()
+
+		return requests
+	}
+}
+
+func testEvent() *diff.Event {
+	return &diff.Event{
+		Type:       watch.Modified,
+		APIVersion: "v1",
+		Kind:       "ConfigMap",
+		Namespace:  "default",
+		Name:       "test",
+		Diff:       "-foo\n+bar\n",
+	}
+}
+
+func TestSendJSON(t *testing.T) {
+	server, requests := startServer(t, 0)
+
+	sink, err := NewSink(&Options{
+		URLs:      []string{server.URL},
+		Secret:    "secret",
+		QueueSize: 10,
+	}, logrus.New())
+	if err != nil {
+		t.Fatalf("Failed to create sink: %v", err)
+	}
+
+	sink.Send(testEvent())
+	sink.Close()
+
+	received := requests()
+	if len(received) != 1 {
+		t.Fatalf("Expected 1 request, got %d.", len(received))
+	}
+
+	event := diff.Event{}
+	if err := json.Unmarshal(received[0].body, &event); err != nil {
+		t.Fatalf("Failed to decode payload: %v", err)
+	}
+
+	if event.Name != "test" || event.Diff != "-foo\n+bar\n" {
+		t.Errorf("Received unexpected event %+v.", event)
+	}
+
+	if received[0].contentType != "application/json" {
+		t.Errorf("Expected content type %q, got %q.", "application/json", received[0].contentType)
+	}
+
+	expected := "sha256=" + Sign(received[0].body, "secret")
+	if received[0].signature != expected {
+		t.Errorf("Expected signature %q, got %q.", expected, received[0].signature)
+	}
+}
+
+func TestSendTemplate(t *testing.T) {
+	server, requests := startServer(t, 0)
+
+	sink, err := NewSink(&Options{
+		URLs:        []string{server.URL},
+		Template:    `{{ .Kind }} {{ .Namespace }}/{{ .Name }} {{ toJson .Type }}`,
+		ContentType: "text/plain",
+		QueueSize:   10,
+	}, logrus.New())
+	if err != nil {
+		t.Fatalf("Failed to create sink: %v", err)
+	}
+
+	sink.Send(testEvent())
+	sink.Close()
+
+	received := requests()
+	if len(received) != 1 {
+		t.Fatalf("Expected 1 request, got %d.", len(received))
+	}
+
+	expected := `ConfigMap default/test "MODIFIED"`
+	if string(received[0].body) != expected {
+		t.Errorf("Expected body %q, got %q.", expected, string(received[0].body))
+	}
+
+	if received[0].signature != "" {
+		t.Errorf("Expected no signature, got %q.", received[0].signature)
+	}
+
+	if received[0].contentType != "text/plain" {
+		t.Errorf("Expected content type %q, got %q.", "text/plain", received[0].contentType)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	server, requests := startServer(t, 2)
+
+	sink, err := NewSink(&Options{
+		URLs:      []string{server.URL},
+		QueueSize: 10,
+		Retries:   2,
+		Backoff:   time.Millisecond,
+	}, logrus.New())
+	if err != nil {
+		t.Fatalf("Failed to create sink: %v", err)
+	}
+
+	sink.Send(testEvent())
+	sink.Close()
+
+	if received := requests(); len(received) != 1 {
+		t.Fatalf("Expected 1 successful request, got %d.", len(received))
+	}
+}
+
+func TestCloseWaitsForRetries(t *testing.T) {
+	server, requests := startServer(t, 1)
+
+	sink, err := NewSink(&Options{
+		URLs:      []string{server.URL},
+		QueueSize: 10,
+		Retries:   1,
+		Backoff:   50 * time.Millisecond,
+	}, logrus.New())
+	if err != nil {
+		t.Fatalf("Failed to create sink: %v", err)
+	}
+
+	sink.Send(testEvent())
+	sink.Send(testEvent())
+	sink.Close()
+
+	if received := requests(); len(received) != 2 {
+		t.Fatalf("Expected 2 successful requests, got %d.", len(received))
+	}
+}
+
+func TestCloseDuringBackoff(t *testing.T) {
+	server, requests := startServer(t, 100)
+
+	sink, err := NewSink(&Options{
+		URLs:            []string{server.URL},
+		QueueSize:       10,
+		Retries:         3,
+		Backoff:         time.Hour,
+		ShutdownTimeout: 10 * time.Millisecond,
+	}, logrus.New())
+	if err != nil {
+		t.Fatalf("Failed to create sink: %v", err)
+	}
+
+	sink.Send(testEvent())
+
+	closed := make(chan struct{})
+	go func() {
+		sink.Close()
+		close(closed)
+	}()
+
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected Close to give up pending retries after the shutdown timeout, but it is still waiting.")
+	}
+
+	if received := requests(); len(received) != 0 {
+		t.Fatalf("Expected no successful request, got %d.", len(received))
+	}
+}
@@ -0,0 +1,257 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+
+	"go.xrstf.de/stalk/pkg/audit"
+	"go.xrstf.de/stalk/pkg/condition"
+	"go.xrstf.de/stalk/pkg/diff"
+	"go.xrstf.de/stalk/pkg/input"
+	kubeutil "go.xrstf.de/stalk/pkg/kubernetes"
+	"go.xrstf.de/stalk/pkg/watcher"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+func watchStdin(ctx context.Context, log logrus.FieldLogger, r io.Reader, filter *input.Filter, printer *diff.Printer) {
+	input.NewDecoder(r).Run(ctx, log, func(event *input.Event) {
+		if filter.Matches(event.Object) {
+			printer.Print(event.Object, event.Type)
+		}
+	})
+}
+
+func watchFiles(ctx context.Context, log logrus.FieldLogger, filter *input.Filter, appOpts *options, printer *diff.Printer) {
+	w := input.NewFileWatcher(appOpts.files, appOpts.filesInterval, log)
+
+	err := w.Run(ctx, func(event *input.Event) {
+		if filter.Matches(event.Object) {
+			printer.Print(event.Object, event.Type)
+		}
+	})
+	if err != nil {
+		log.Fatalf("Failed to watch files: %v", err)
+	}
+}
+
+func watchAudit(ctx context.Context, log logrus.FieldLogger, filter *input.Filter, appOpts *options, printer *diff.Printer) {
+	err := audit.NewReplayer(log).Run(ctx, appOpts.auditLog, appOpts.auditWebhookAddr, func(change *audit.Change) {
+		if filter.Matches(change.Object) {
+			printer.PrintChange(change.Object, change.Type, change.Actor)
+		}
+	})
+	if err != nil {
+		log.Fatalf("Failed to replay audit events: %v", err)
+	}
+}
+
+func watchKubernetes(ctx context.Context, log logrus.FieldLogger, args []string, resolver *kubeutil.Resolver, appOpts *options, printer *diff.Printer, tracker *condition.Tracker) {
+	resourceNames := args[1:]
+	parseSelector(log, appOpts, resourceNames)
+
+	kinds, err := resolver.ResolveKinds(args[0])
+	if err != nil {
+		log.Fatalf("Failed to resolve resource kinds: %v", err)
+	}
+
+	// setup watches for each kind
+	log.Debug("Starting to watch resources...")
+
+	wg := sync.WaitGroup{}
+	w := watcher.NewWatcher(printer, log, appOpts.namespaces, resourceNames)
+
+	for _, gvk := range kinds {
+		dynamicInterface, err := resolver.ResourceInterfaceFor(gvk)
+		if err != nil {
+			log.Fatalf("Failed to create dynamic interface for %q resources: %v", gvk.Kind, err)
+		}
+
+		// the tracker must know all existing resources before the first events arrive
+		if tracker != nil {
+			existing, err := w.List(ctx, dynamicInterface, appOpts.labels)
+			if err != nil {
+				log.Fatalf("Failed to list %q resources: %v", gvk.Kind, err)
+			}
+
+			for _, obj := range existing {
+				tracker.Expect(obj)
+			}
+		}
+
+		wg.Add(1)
+		go func() {
+			runWatch(ctx, log, w, gvk, dynamicInterface, appOpts)
+			wg.Done()
+		}()
+	}
+
+	wg.Wait()
+}
+
+// watchClusters watches the same resources in two clusters and shows the
+// differences between both versions of each object.
+func watchClusters(ctx context.Context, log logrus.FieldLogger, args []string, resolvers [2]*kubeutil.Resolver, appOpts *options, printer *diff.Printer) {
+	resourceNames := args[1:]
+	parseSelector(log, appOpts, resourceNames)
+
+	contextA := appOpts.kubeContext
+	if contextA == "" {
+		contextA = kubeutil.CurrentContext(appOpts.kubeconfig)
+	}
+
+	contexts := [2]string{contextA, appOpts.compareContext}
+	comparison := diff.NewComparison(printer, contexts[0], contexts[1])
+
+	type clusterWatch struct {
+		log     logrus.FieldLogger
+		watcher *watcher.Watcher
+		gvk     schema.GroupVersionKind
+		client  dynamic.ResourceInterface
+	}
+
+	// load both clusters before watching, so slow watches do not look like missing objects
+	watches := []clusterWatch{}
+
+	for side, resolver := range resolvers {
+		clusterLog := log.WithField("context", contexts[side])
+		w := watcher.NewWatcher(comparison.Side(side), clusterLog, appOpts.namespaces, resourceNames)
+
+		kinds, err := resolver.ResolveKinds(args[0])
+		if err != nil {
+			clusterLog.Fatalf("Failed to resolve resource kinds: %v", err)
+		}
+
+		for _, gvk := range kinds {
+			dynamicInterface, err := resolver.ResourceInterfaceFor(gvk)
+			if err != nil {
+				clusterLog.Fatalf("Failed to create dynamic interface for %q resources: %v", gvk.Kind, err)
+			}
+
+			existing, err := w.List(ctx, dynamicInterface, appOpts.labels)
+			if err != nil {
+				clusterLog.Fatalf("Failed to list %q resources: %v", gvk.Kind, err)
+			}
+
+			comparison.Load(side, existing)
+
+			watches = append(watches, clusterWatch{
+				log:     clusterLog,
+				watcher: w,
+				gvk:     gvk,
+				client:  dynamicInterface,
+			})
+		}
+	}
+
+	comparison.Start()
+
+	log.Debug("Starting to watch resources...")
+
+	wg := sync.WaitGroup{}
+	for _, cw := range watches {
+		wg.Add(1)
+		go func() {
+			runWatch(ctx, cw.log, cw.watcher, cw.gvk, cw.client, appOpts)
+			wg.Done()
+		}()
+	}
+
+	wg.Wait()
+}
+
+func runWatch(ctx context.Context, log logrus.FieldLogger, w *watcher.Watcher, gvk schema.GroupVersionKind, client dynamic.ResourceInterface, appOpts *options) {
+	err := w.RunClient(ctx, gvk, client, appOpts.labels)
+	if err != nil && ctx.Err() == nil {
+		log.Fatalf("Failed to create watch for %q resources: %v", gvk.Kind, err)
+	}
+}
+
+// waitForCondition cancels the context once the tracker is done.
+func waitForCondition(ctx context.Context, cancel context.CancelFunc, tracker *condition.Tracker) {
+	select {
+	case <-tracker.Done():
+		cancel()
+	case <-ctx.Done():
+	}
+}
+
+// diffFiles compares the objects in both files and returns the exit code,
+// 1 if any differences were found and 0 otherwise.
+func diffFiles(log logrus.FieldLogger, differ *diff.Differ, filter *input.Filter, fileA, fileB string) int {
+	objectsA, err := input.ReadFile(fileA)
+	if err != nil {
+		log.Fatalf("Failed to read %s: %v", fileA, err)
+	}
+
+	objectsB, err := input.ReadFile(fileB)
+	if err != nil {
+		log.Fatalf("Failed to read %s: %v", fileB, err)
+	}
+
+	byKey := map[string]*unstructured.Unstructured{}
+	for _, obj := range objectsB {
+		byKey[input.ObjectKey(obj)] = obj
+	}
+
+	different := false
+	onlyA := []*unstructured.Unstructured{}
+
+	for _, objA := range objectsA {
+		key := input.ObjectKey(objA)
+
+		objB, exists := byKey[key]
+		if !exists {
+			if filter.Matches(objA) {
+				onlyA = append(onlyA, objA)
+			}
+
+			continue
+		}
+
+		delete(byKey, key)
+
+		if !filter.Matches(objA) && !filter.Matches(objB) {
+			continue
+		}
+
+		event, err := differ.CompareObjects(objA, objB, fileA, fileB)
+		if err != nil {
+			log.Fatalf("Failed to compare %s: %v", key, err)
+		}
+
+		if event != nil && event.OldDocument != event.NewDocument {
+			different = true
+		}
+	}
+
+	onlyB := []*unstructured.Unstructured{}
+	for _, objB := range objectsB {
+		if _, exists := byKey[input.ObjectKey(objB)]; exists && filter.Matches(objB) {
+			onlyB = append(onlyB, objB)
+		}
+	}
+
+	for _, obj := range onlyA {
+		fmt.Printf("Only in %s: %s\n", fileA, differ.DescribeObject(obj))
+	}
+
+	for _, obj := range onlyB {
+		fmt.Printf("Only in %s: %s\n", fileB, differ.DescribeObject(obj))
+	}
+
+	if different || len(onlyA) > 0 || len(onlyB) > 0 {
+		return 1
+	}
+
+	return 0
+}